@@ -1,22 +1,26 @@
 package wecom
 
 import (
-	"encoding/json"
+	"context"
 	"net/url"
 )
 
 // UserIdGetFromCode 通过code获取用户ID
 func (w *Wecom) UserIdGetFromCode(code string) (string, error) {
+	return w.UserIdGetFromCodeContext(context.Background(), code)
+}
+
+// UserIdGetFromCodeContext 同UserIdGetFromCode，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserIdGetFromCodeContext(ctx context.Context, code string) (string, error) {
 	var query = url.Values{}
 	query.Add("code", code)
-	body, err := w.get("auth/getuserinfo", query)
-	if err != nil {
-		return "", err
+	var r struct {
+		Error
+		UserID string `json:"userid"`
 	}
-	var userid string
-	err = json.Unmarshal(body["userid"], &userid)
+	err := w.get(ctx, "auth/getuserinfo", query, &r)
 	if err != nil {
 		return "", err
 	}
-	return userid, nil
+	return r.UserID, nil
 }
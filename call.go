@@ -0,0 +1,66 @@
+package wecom
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-querystring/query"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Call 调用本包未封装的企业微信接口，复用token管理、重试、限流、中间件与错误码校验
+// method - http.MethodGet 或 http.MethodPost
+// p - 接口路径，如"externalcontact/list"或"/cgi-bin/externalcontact/list"
+// req - GET请求时编码为url参数，支持url.Values、map[string]string及带url标签的结构体；POST请求时序列化为json
+// Resp - 响应结构，内嵌Error时只需一次json解析
+func Call[Req, Resp any](ctx context.Context, w *Wecom, method, p string, req Req) (*Resp, error) {
+	p = strings.TrimPrefix(p, basePath)
+	var resp Resp
+	switch method {
+	case http.MethodGet:
+		q, err := encodeQuery(req)
+		if err != nil {
+			return nil, err
+		}
+		err = w.get(ctx, p, q, &resp)
+		if err != nil {
+			return nil, err
+		}
+	case http.MethodPost:
+		err := w.post(ctx, p, req, &resp)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported method %s", method)
+	}
+	return &resp, nil
+}
+
+// Get 以GET方式调用本包未封装的企业微信接口
+func Get[Resp any](ctx context.Context, w *Wecom, p string, query url.Values) (*Resp, error) {
+	return Call[url.Values, Resp](ctx, w, http.MethodGet, p, query)
+}
+
+// Post 以POST方式调用本包未封装的企业微信接口
+func Post[Req, Resp any](ctx context.Context, w *Wecom, p string, req Req) (*Resp, error) {
+	return Call[Req, Resp](ctx, w, http.MethodPost, p, req)
+}
+
+// encodeQuery 将GET请求参数编码为url.Values
+func encodeQuery(v any) (url.Values, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case url.Values:
+		return t, nil
+	case map[string]string:
+		q := url.Values{}
+		for k, val := range t {
+			q.Set(k, val)
+		}
+		return q, nil
+	}
+	return query.Values(v)
+}
@@ -2,8 +2,21 @@ package wecom
 
 import (
 	"encoding/xml"
+	"errors"
 )
 
+func init() {
+	RegisterEventParser(EventKey{MsgType: "event", Event: "change_contact"}, func(raw []byte) (any, error) {
+		return ParseChangeContact(raw)
+	})
+	RegisterEventParser(EventKey{MsgType: "event", Event: "batch_job_result"}, func(raw []byte) (any, error) {
+		return ParseBatchJobEvent(raw)
+	})
+	for _, t := range []string{MsgTypeText, MsgTypeImage, MsgTypeVoice, MsgTypeVideo, MsgTypeLocation, MsgTypeLink} {
+		RegisterEventParser(EventKey{MsgType: t}, ParseUserMsg)
+	}
+}
+
 func ParseEvent(body []byte) (*CallbackEvent, error) {
 	var evt CallbackEvent
 	err := xml.Unmarshal(body, &evt)
@@ -13,18 +26,82 @@ func ParseEvent(body []byte) (*CallbackEvent, error) {
 	return &evt, nil
 }
 
-func ParseBatchJob(b []byte) ([]BatchJob, error) {
-	var a = make(map[string][]byte)
-	err := xml.Unmarshal(b, &a)
+// ParseChangeContact 解析通讯录变更事件
+// 返回值按ChangeType区分：*ContactUserEvent、*ContactPartyEvent、*ContactTagEvent，未收录的类型返回nil
+func ParseChangeContact(body []byte) (any, error) {
+	var evt CallbackEvent
+	err := xml.Unmarshal(body, &evt)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	switch evt.ChangeType {
+	case "create_user", "update_user", "delete_user":
+		v = &ContactUserEvent{}
+	case "create_party", "update_party", "delete_party":
+		v = &ContactPartyEvent{}
+	case "update_tag":
+		v = &ContactTagEvent{}
+	default:
+		return nil, nil
+	}
+	err = xml.Unmarshal(body, v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ParseBatchJob 解析异步任务完成事件中的任务信息
+func ParseBatchJob(b []byte) (*BatchJob, error) {
+	evt, err := ParseBatchJobEvent(b)
 	if err != nil {
 		return nil, err
 	}
-	var r []BatchJob
-	if v, ok := a["BatchJob"]; ok {
-		err = xml.Unmarshal(v, &r)
-		if err != nil {
-			return nil, err
-		}
+	return &evt.BatchJob, nil
+}
+
+// ParseBatchJobEvent 解析异步任务完成事件
+func ParseBatchJobEvent(b []byte) (*BatchJobEvent, error) {
+	var evt BatchJobEvent
+	err := xml.Unmarshal(b, &evt)
+	if err != nil {
+		return nil, err
+	}
+	if evt.BatchJob.JobId == "" {
+		return nil, errors.New("wecom: missing BatchJob in batch_job_result event")
+	}
+	return &evt, nil
+}
+
+// ParseUserMsg 解析用户消息
+// 返回值按MsgType区分：*TextMsg、*ImageMsg、*VoiceMsg、*VideoMsg、*LocationMsg、*LinkMsg，未收录的类型返回nil
+func ParseUserMsg(body []byte) (any, error) {
+	var evt CallbackEvent
+	err := xml.Unmarshal(body, &evt)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	switch evt.MsgType {
+	case MsgTypeText:
+		v = &TextMsg{}
+	case MsgTypeImage:
+		v = &ImageMsg{}
+	case MsgTypeVoice:
+		v = &VoiceMsg{}
+	case MsgTypeVideo:
+		v = &VideoMsg{}
+	case MsgTypeLocation:
+		v = &LocationMsg{}
+	case MsgTypeLink:
+		v = &LinkMsg{}
+	default:
+		return nil, nil
+	}
+	err = xml.Unmarshal(body, v)
+	if err != nil {
+		return nil, err
 	}
-	return r, nil
+	return v, nil
 }
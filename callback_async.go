@@ -0,0 +1,149 @@
+package wecom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// 企业微信要求5秒内响应回调，耗时的处理可开启异步模式：
+// 消息解密、排重后放入队列并立即响应200，由后台worker调用处理函数
+// 异步模式下无法被动回复，evt.Reply设置的回复会被忽略
+
+const (
+	defaultCallbackWorkers    = 4
+	defaultCallbackQueueSize  = 1000
+	defaultCallbackRetries    = 3
+	defaultCallbackRetryDelay = time.Second
+	maxCallbackRetryDelay     = 30 * time.Second
+)
+
+var (
+	ErrCallbackQueueFull = errors.New("wecom: callback queue full")
+	ErrCallbackClosed    = errors.New("wecom: callback server closed")
+)
+
+// CallbackAsync 开启异步处理
+// workers - 处理消息的worker数量，小于等于0时为4
+// queueSize - 队列长度，队列已满时响应503，由企业微信稍后重试，小于等于0时为1000
+func CallbackAsync(workers, queueSize int) CallbackOption {
+	return func(s *CallbackServer) {
+		if workers <= 0 {
+			workers = defaultCallbackWorkers
+		}
+		if queueSize <= 0 {
+			queueSize = defaultCallbackQueueSize
+		}
+		s.workers = workers
+		s.queue = make(chan *Event, queueSize)
+	}
+}
+
+// CallbackRetry 设置异步处理失败时的重试次数与首次重试的间隔，间隔按指数增长，默认重试3次、间隔1秒
+func CallbackRetry(retries int, delay time.Duration) CallbackOption {
+	return func(s *CallbackServer) {
+		s.retries = retries
+		if delay > 0 {
+			s.retryDelay = delay
+		}
+	}
+}
+
+// CallbackOnHandlerError 设置异步处理在重试后仍失败时的回调，可用于记录日志或持久化待补偿的消息
+func CallbackOnHandlerError(fn func(evt *Event, err error)) CallbackOption {
+	return func(s *CallbackServer) {
+		s.onHandlerError = fn
+	}
+}
+
+// startWorkers 启动异步处理的worker
+func (s *CallbackServer) startWorkers() {
+	s.workerCtx, s.cancelWorkers = context.WithCancel(context.Background())
+	for i := 0; i < s.workers; i++ {
+		s.workerWG.Add(1)
+		go s.work()
+	}
+}
+
+func (s *CallbackServer) work() {
+	defer s.workerWG.Done()
+	for evt := range s.queue {
+		err := s.dispatchRetry(s.workerCtx, evt)
+		if err == nil {
+			continue
+		}
+		s.release(context.Background(), evt)
+		if s.onHandlerError != nil {
+			s.onHandlerError(evt, err)
+		}
+	}
+}
+
+// dispatchRetry 调用处理函数，失败时按指数退避重试
+func (s *CallbackServer) dispatchRetry(ctx context.Context, evt *Event) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = s.safeDispatch(ctx, evt)
+		if err == nil || attempt >= s.retries {
+			return err
+		}
+		if serr := sleepContext(ctx, backoffDelay(s.retryDelay, maxCallbackRetryDelay, attempt+1)); serr != nil {
+			return err
+		}
+	}
+}
+
+// safeDispatch 同Dispatch，处理函数panic时转为错误返回
+func (s *CallbackServer) safeDispatch(ctx context.Context, evt *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("wecom: callback handler panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return s.Dispatch(ctx, evt)
+}
+
+// enqueue 将消息放入异步处理队列
+func (s *CallbackServer) enqueue(evt *Event) error {
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+	if s.closed {
+		return ErrCallbackClosed
+	}
+	select {
+	case s.queue <- evt:
+		return nil
+	default:
+		return ErrCallbackQueueFull
+	}
+}
+
+// Shutdown 停止接收新的消息，并等待队列中的消息处理完成
+// ctx结束时取消正在执行的处理函数与重试，并返回ctx的错误；未开启异步处理时直接返回
+func (s *CallbackServer) Shutdown(ctx context.Context) error {
+	if s.queue == nil {
+		return nil
+	}
+	s.queueMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.workerWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancelWorkers()
+		return nil
+	case <-ctx.Done():
+		s.cancelWorkers()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,180 @@
+package wecom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newAsyncCallbackServer 创建开启异步处理的回调服务，测试结束时关闭
+func newAsyncCallbackServer(t *testing.T, h EventHandler, opts ...CallbackOption) *CallbackServer {
+	t.Helper()
+	cs, err := NewCallbackServer(testCallbackToken, testCallbackKey, testCallbackCorp,
+		append([]CallbackOption{CallbackAsync(1, 10)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.HandleMsg(MsgTypeText, h)
+	t.Cleanup(func() { _ = cs.Shutdown(context.Background()) })
+	return cs
+}
+
+func postCallback(t *testing.T, cs *CallbackServer, msgID string) {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	cs.ServeHTTP(rw, newCallbackRequest(t, cs.MsgCrypt(), testTextMsg(msgID)))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rw.Code)
+	}
+}
+
+func TestCallbackAsyncRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+	)
+	cs := newAsyncCallbackServer(t, func(ctx context.Context, evt *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}, CallbackRetry(3, 20*time.Millisecond), CallbackOnHandlerError(func(evt *Event, err error) {
+		t.Errorf("OnHandlerError called after success: %v", err)
+	}))
+
+	postCallback(t, cs, "1")
+	if err := cs.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 3 {
+		t.Fatalf("attempts = %d, want 3", len(attempts))
+	}
+	// 重试间隔按指数增长：20ms、40ms
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if d := attempts[i+1].Sub(attempts[i]); d < want {
+			t.Errorf("retry %d after %v, want at least %v", i+1, d, want)
+		}
+	}
+}
+
+func TestCallbackAsyncHandlerError(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		failed   []string
+	)
+	cs := newAsyncCallbackServer(t, func(ctx context.Context, evt *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		return errors.New("permanent failure")
+	}, CallbackRetry(2, time.Millisecond), CallbackDedup(NewMemoryDedupStore(0)),
+		CallbackOnHandlerError(func(evt *Event, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, evt.MsgId+": "+err.Error())
+		}))
+
+	postCallback(t, cs, "1")
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failed) == 1
+	})
+	mu.Lock()
+	if attempts != 3 || failed[0] != "1: permanent failure" {
+		t.Fatalf("attempts = %d, failed = %v", attempts, failed)
+	}
+	mu.Unlock()
+
+	// 最终失败后释放排重记录，企业微信重试推送时可再次处理
+	postCallback(t, cs, "1")
+	if err := cs.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 6 || len(failed) != 2 {
+		t.Fatalf("attempts = %d, failed = %v after redelivery", attempts, failed)
+	}
+}
+
+func TestCallbackAsyncPanic(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		handled  []string
+		failures []error
+	)
+	cs := newAsyncCallbackServer(t, func(ctx context.Context, evt *Event) error {
+		if evt.MsgId == "panic" {
+			panic("boom")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, evt.MsgId)
+		return nil
+	}, CallbackRetry(0, time.Millisecond), CallbackOnHandlerError(func(evt *Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, err)
+	}))
+
+	postCallback(t, cs, "panic")
+	postCallback(t, cs, "2")
+	if err := cs.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// panic转为错误，worker继续处理后续消息
+	if len(failures) != 1 || !strings.Contains(failures[0].Error(), "callback handler panic: boom") {
+		t.Fatalf("failures = %v", failures)
+	}
+	if len(handled) != 1 || handled[0] != "2" {
+		t.Fatalf("handled = %v, want [2]", handled)
+	}
+}
+
+func TestCallbackAsyncShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	cs := newAsyncCallbackServer(t, func(ctx context.Context, evt *Event) error {
+		close(started)
+		<-ctx.Done()
+		handlerErr <- ctx.Err()
+		return ctx.Err()
+	}, CallbackRetry(0, time.Millisecond))
+
+	postCallback(t, cs, "1")
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := cs.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want deadline exceeded", err)
+	}
+	// 超时后取消正在执行的处理函数
+	select {
+	case err := <-handlerErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("handler ctx err = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler ctx was not cancelled after Shutdown timed out")
+	}
+}
+
+// waitFor 等待条件成立，最多1秒
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
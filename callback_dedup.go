@@ -0,0 +1,230 @@
+package wecom
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 企业微信在5秒内未收到响应时会重试推送，最多3次
+// 排重方式：有MsgId的消息使用MsgId，事件使用FromUserName+CreateTime
+
+// defaultDedupRetention 默认的排重记录保留时间
+const defaultDedupRetention = 10 * time.Minute
+
+// DedupStore 回调消息的排重存储
+type DedupStore interface {
+	// Add 记录key并保留ttl时间，key已存在且未过期时返回false
+	Add(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Remove 删除key，处理失败时调用，使企业微信重试时可再次处理
+	Remove(ctx context.Context, key string) error
+}
+
+// CallbackDedup 开启回调排重，已成功处理过的消息再次推送时直接响应200
+func CallbackDedup(store DedupStore) CallbackOption {
+	return func(s *CallbackServer) {
+		s.dedup = store
+	}
+}
+
+// CallbackDedupRetention 设置排重记录的保留时间，默认10分钟
+func CallbackDedupRetention(d time.Duration) CallbackOption {
+	return func(s *CallbackServer) {
+		s.dedupTTL = d
+	}
+}
+
+// CallbackDedupKey 自定义排重的key，默认为DedupKey
+func CallbackDedupKey(fn func(evt *Event) string) CallbackOption {
+	return func(s *CallbackServer) {
+		s.dedupKey = fn
+	}
+}
+
+// DedupKey 回调消息默认的排重key
+// 有MsgId时使用MsgId；否则使用FromUserName+CreateTime+Event
+// 同一秒内的多个同类事件会被视为重复，需要区分时可通过CallbackDedupKey附加ChangeType、UserID等字段
+func DedupKey(evt *Event) string {
+	if evt.MsgId != "" {
+		return "msg:" + evt.MsgId
+	}
+	return fmt.Sprintf("event:%s:%d:%s", evt.FromUserName, evt.CreateTime, evt.Event)
+}
+
+// acquire 记录消息，消息已处理过时返回false
+func (s *CallbackServer) acquire(ctx context.Context, evt *Event) (bool, error) {
+	if s.dedup == nil {
+		return true, nil
+	}
+	return s.dedup.Add(ctx, s.dedupKey(evt), s.dedupTTL)
+}
+
+// release 删除处理失败的消息的记录
+func (s *CallbackServer) release(ctx context.Context, evt *Event) {
+	if s.dedup == nil {
+		return
+	}
+	_ = s.dedup.Remove(ctx, s.dedupKey(evt))
+}
+
+// MemoryDedupStore 基于LRU的内存排重存储，超过容量时淘汰最久未写入的记录
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // 头部为最近写入的记录
+}
+
+type dedupItem struct {
+	key    string
+	expire time.Time
+}
+
+// NewMemoryDedupStore 创建内存排重存储
+// capacity - 最多保留的记录数，小于等于0时为10000
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryDedupStore{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *MemoryDedupStore) Add(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		item := e.Value.(*dedupItem)
+		if now.Before(item.expire) {
+			return false, nil
+		}
+		item.expire = now.Add(ttl)
+		s.order.MoveToFront(e)
+		return true, nil
+	}
+	s.items[key] = s.order.PushFront(&dedupItem{key: key, expire: now.Add(ttl)})
+	for s.order.Len() > s.capacity {
+		s.removeElement(s.order.Back())
+	}
+	// 顺带清理尾部已过期的记录
+	for e := s.order.Back(); e != nil && !now.Before(e.Value.(*dedupItem).expire); e = s.order.Back() {
+		s.removeElement(e)
+	}
+	return true, nil
+}
+
+func (s *MemoryDedupStore) Remove(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.removeElement(e)
+	}
+	return nil
+}
+
+func (s *MemoryDedupStore) removeElement(e *list.Element) {
+	s.order.Remove(e)
+	delete(s.items, e.Value.(*dedupItem).key)
+}
+
+// FileDedupStore 基于文件的排重存储，同一台机器或共享目录上的多个进程可共享排重记录
+// 每个key对应目录下的一个文件，内容为过期时间，写入通过独占创建文件实现
+type FileDedupStore struct {
+	dir string
+}
+
+func NewFileDedupStore(dir string) (*FileDedupStore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDedupStore{dir: dir}, nil
+}
+
+func (s *FileDedupStore) Add(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	p := s.path(key)
+	expire := strconv.FormatInt(time.Now().Add(ttl).UnixNano(), 10)
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = f.WriteString(expire)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				_ = os.Remove(p)
+				return false, err
+			}
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+		if !dedupExpired(p) {
+			return false, nil
+		}
+		// 记录已过期，删除后重新写入
+		_ = os.Remove(p)
+	}
+	return false, nil
+}
+
+func (s *FileDedupStore) Remove(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Purge 删除所有已过期的记录
+func (s *FileDedupStore) Purge() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".dedup") {
+			continue
+		}
+		p := filepath.Join(s.dir, e.Name())
+		if dedupExpired(p) {
+			_ = os.Remove(p)
+		}
+	}
+	return nil
+}
+
+// path key中可能包含不能作为文件名的字符，使用其摘要作为文件名
+func (s *FileDedupStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:16])+".dedup")
+}
+
+// dedupExpired 判断记录文件是否已过期，内容无法解析且超过1分钟未更新时视为过期
+func dedupExpired(p string) bool {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		// 可能是其他进程正在写入
+		fi, serr := os.Stat(p)
+		return serr == nil && time.Since(fi.ModTime()) > time.Minute
+	}
+	return time.Now().UnixNano() >= n
+}
@@ -0,0 +1,139 @@
+package wecom
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedupKey(t *testing.T) {
+	evt := func(msgID string, raw string) *Event {
+		e := &Event{Raw: []byte(raw)}
+		e.FromUserName = "sys"
+		e.CreateTime = 1403610513
+		e.MsgType = "event"
+		e.Event = "change_contact"
+		e.MsgId = msgID
+		return e
+	}
+	if got := DedupKey(evt("1234567890123456", "")); got != "msg:1234567890123456" {
+		t.Errorf("DedupKey = %q", got)
+	}
+	// 企业微信重试时明文可能不完全一致，key只取决于FromUserName+CreateTime+Event
+	a := DedupKey(evt("", "<xml><ChangeType>update_user</ChangeType></xml>"))
+	b := DedupKey(evt("", "<xml> <ChangeType>update_user</ChangeType> </xml>"))
+	if a != b || a != "event:sys:1403610513:change_contact" {
+		t.Errorf("DedupKey = %q, %q", a, b)
+	}
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	add := func(s DedupStore, key string, ttl time.Duration) bool {
+		t.Helper()
+		ok, err := s.Add(ctx, key, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	s := NewMemoryDedupStore(2)
+	if !add(s, "a", time.Hour) || add(s, "a", time.Hour) {
+		t.Fatal("second Add of the same key should return false")
+	}
+	if err := s.Remove(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if !add(s, "a", time.Hour) {
+		t.Fatal("removed key should be added again")
+	}
+
+	// 超过容量时淘汰最久未写入的记录
+	add(s, "b", time.Hour)
+	add(s, "c", time.Hour)
+	if !add(s, "a", time.Hour) {
+		t.Error("oldest key should be evicted at capacity")
+	}
+	if add(s, "c", time.Hour) {
+		t.Error("recent key should be kept")
+	}
+
+	// 过期后可再次写入
+	s = NewMemoryDedupStore(0)
+	add(s, "x", 20*time.Millisecond)
+	if add(s, "x", time.Hour) {
+		t.Fatal("key should not be added before expiry")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !add(s, "x", time.Hour) {
+		t.Fatal("expired key should be added again")
+	}
+}
+
+func TestFileDedupStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewFileDedupStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Add(ctx, "event:sys:1:change_contact", time.Hour); err != nil || !ok {
+		t.Fatalf("Add = %v, %v", ok, err)
+	}
+	if _, err = s.Add(ctx, "short", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// 进程重启后仍能识别已处理的消息
+	s, err = NewFileDedupStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Add(ctx, "event:sys:1:change_contact", time.Hour); ok {
+		t.Fatal("key should survive a restart")
+	}
+	if ok, _ := s.Add(ctx, "short", time.Hour); ok {
+		t.Fatal("key should not be added before expiry")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err = s.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.dedup"))
+	if len(files) != 1 {
+		t.Fatalf("Purge left %d files, want 1", len(files))
+	}
+	if ok, _ := s.Add(ctx, "short", time.Hour); !ok {
+		t.Fatal("purged key should be added again")
+	}
+
+	if err = s.Remove(ctx, "short"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Remove(ctx, "short"); err != nil {
+		t.Fatalf("Remove of a missing key = %v", err)
+	}
+	if ok, _ := s.Add(ctx, "short", time.Hour); !ok {
+		t.Fatal("removed key should be added again")
+	}
+
+	// 无法解析的记录在超过1分钟后视为过期
+	p := s.path("broken")
+	if err = os.WriteFile(p, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Add(ctx, "broken", time.Hour); ok {
+		t.Fatal("record being written should not be replaced")
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	if err = os.Chtimes(p, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Add(ctx, "broken", time.Hour); !ok {
+		t.Fatal("stale broken record should be replaced")
+	}
+}
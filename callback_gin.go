@@ -0,0 +1,126 @@
+package wecom
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GinEventKey gin.Context中保存解密后回调消息的key
+const GinEventKey = "wecom.event"
+
+// GinRegister 在路由上注册回调地址，GET用于URL验证，POST接收消息
+// handlers - 接收消息后执行的处理函数，可通过GinEvent获取消息，为空时分发到CallbackServer注册的处理函数
+//
+//	cs.GinRegister(r, "/wecom/callback")
+//	cs.GinRegister(r, "/wecom/callback", func(c *gin.Context) {
+//		evt, _ := wecom.GinEvent(c)
+//		...
+//	})
+func (s *CallbackServer) GinRegister(r gin.IRoutes, relativePath string, handlers ...gin.HandlerFunc) {
+	if len(handlers) == 0 {
+		handlers = []gin.HandlerFunc{s.GinDispatch()}
+	}
+	r.GET(relativePath, s.GinVerify())
+	r.POST(relativePath, append([]gin.HandlerFunc{s.GinReceive()}, handlers...)...)
+}
+
+// GinVerify 回调URL验证的处理函数
+func (s *CallbackServer) GinVerify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.serveVerify(c.Writer, c.Request)
+	}
+}
+
+// GinReceive 校验签名并解密消息，保存到gin.Context后执行后续的处理函数
+// 后续处理函数未写入响应时，根据c.Errors响应错误（默认500，处理函数已通过c.Status设置4xx/5xx时使用该状态码），
+// 或响应evt.Reply设置的被动回复，否则响应200
+func (s *CallbackServer) GinReceive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		evt, status, err := s.Decode(c.Request)
+		if err != nil {
+			s.fail(c.Writer, c.Request, status, err)
+			c.Abort()
+			return
+		}
+		first, err := s.acquire(c.Request.Context(), evt)
+		if err != nil {
+			s.fail(c.Writer, c.Request, http.StatusInternalServerError, err)
+			c.Abort()
+			return
+		}
+		if !first {
+			c.AbortWithStatus(http.StatusOK)
+			return
+		}
+		c.Set(GinEventKey, evt)
+		c.Next()
+		if ge := c.Errors.Last(); ge != nil {
+			s.release(c.Request.Context(), evt)
+			if !c.Writer.Written() {
+				status := c.Writer.Status()
+				if status < http.StatusBadRequest {
+					status = http.StatusInternalServerError
+				}
+				s.fail(c.Writer, c.Request, status, ge.Err)
+			}
+			return
+		}
+		if c.Writer.Written() {
+			return
+		}
+		if evt.reply == nil {
+			c.Status(http.StatusOK)
+			return
+		}
+		b, err := s.encryptEventReply(c.Request, evt)
+		if err != nil {
+			s.release(c.Request.Context(), evt)
+			s.fail(c.Writer, c.Request, http.StatusInternalServerError, err)
+			return
+		}
+		c.Data(http.StatusOK, "text/xml; charset=utf-8", b)
+	}
+}
+
+// GinDispatch 将消息分发到CallbackServer注册的处理函数，需在GinReceive之后执行
+// 开启异步处理时放入队列后立即返回
+func (s *CallbackServer) GinDispatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		evt, ok := GinEvent(c)
+		if !ok {
+			return
+		}
+		if s.queue != nil {
+			err := s.enqueue(evt)
+			if err != nil {
+				_ = c.Error(err)
+				c.Status(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		err := s.Dispatch(c.Request.Context(), evt)
+		if err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// GinReply 加密并写入被动回复，msg为明文的xml回复消息，可通过MarshalReply生成
+func (s *CallbackServer) GinReply(c *gin.Context, msg []byte) error {
+	b, err := s.EncryptReply(c.Request, msg)
+	if err != nil {
+		return err
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", b)
+	return nil
+}
+
+// GinEvent 获取GinReceive保存的回调消息
+func GinEvent(c *gin.Context) (*Event, bool) {
+	v, ok := c.Get(GinEventKey)
+	if !ok {
+		return nil, false
+	}
+	evt, ok := v.(*Event)
+	return evt, ok
+}
@@ -0,0 +1,159 @@
+package wecom
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testCallbackToken = "QDG6eK"
+	testCallbackKey   = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	testCallbackCorp  = "wx5823bf96d3bd56c7"
+)
+
+// newCallbackRequest 生成签名、加密后的回调请求
+func newCallbackRequest(t *testing.T, crypt *MsgCrypt, msg string) *http.Request {
+	t.Helper()
+	encrypted, err := crypt.Encrypt([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := url.Values{
+		"msg_signature": {crypt.Signature("1409659813", "1372623149", encrypted)},
+		"timestamp":     {"1409659813"},
+		"nonce":         {"1372623149"},
+	}
+	body := "<xml><ToUserName><![CDATA[" + testCallbackCorp + "]]></ToUserName><Encrypt><![CDATA[" + encrypted + "]]></Encrypt></xml>"
+	return httptest.NewRequest(http.MethodPost, "/callback?"+q.Encode(), strings.NewReader(body))
+}
+
+func testTextMsg(msgID string) string {
+	return "<xml><ToUserName><![CDATA[" + testCallbackCorp + "]]></ToUserName><FromUserName><![CDATA[zhangsan]]></FromUserName>" +
+		"<CreateTime>1348831860</CreateTime><MsgType><![CDATA[text]]></MsgType><Content><![CDATA[hello]]></Content>" +
+		"<MsgId>" + msgID + "</MsgId><AgentID>1</AgentID></xml>"
+}
+
+func newTestGinEngine(cs *CallbackServer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	cs.GinRegister(r, "/callback")
+	return r
+}
+
+func TestGinReceiveReply(t *testing.T) {
+	cs, err := NewCallbackServer(testCallbackToken, testCallbackKey, testCallbackCorp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.HandleMsg(MsgTypeText, func(ctx context.Context, evt *Event) error {
+		evt.Reply(NewTextReply("world"))
+		return nil
+	})
+	r := newTestGinEngine(cs)
+
+	for name, h := range map[string]http.Handler{"gin": r, "net/http": cs} {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, newCallbackRequest(t, cs.MsgCrypt(), testTextMsg("1")))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", name, rw.Code)
+		}
+		var reply struct {
+			MsgSignature string `xml:"MsgSignature"`
+			TimeStamp    string `xml:"TimeStamp"`
+			Nonce        string `xml:"Nonce"`
+		}
+		if err = xml.Unmarshal(rw.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		plain, err := cs.MsgCrypt().DecryptMsg(reply.MsgSignature, reply.TimeStamp, reply.Nonce, rw.Body.Bytes())
+		if err != nil {
+			t.Fatalf("%s: decrypt reply: %v", name, err)
+		}
+		if !strings.Contains(string(plain), "<Content><![CDATA[world]]></Content>") {
+			t.Fatalf("%s: reply = %s", name, plain)
+		}
+	}
+}
+
+func TestGinReceiveHandlerError(t *testing.T) {
+	var errs []error
+	cs, err := NewCallbackServer(testCallbackToken, testCallbackKey, testCallbackCorp,
+		CallbackDedup(NewMemoryDedupStore(0)),
+		CallbackOnError(func(r *http.Request, err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	cs.HandleMsg(MsgTypeText, func(ctx context.Context, evt *Event) error {
+		calls++
+		if calls == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+	r := newTestGinEngine(cs)
+
+	want := []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK}
+	for i, code := range want {
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, newCallbackRequest(t, cs.MsgCrypt(), testTextMsg("2")))
+		if rw.Code != code {
+			t.Fatalf("request %d: status = %d, want %d", i, rw.Code, code)
+		}
+	}
+	// 失败后释放排重记录，重试时再次处理；成功后的重试不再处理
+	if calls != 2 {
+		t.Fatalf("handler calls = %d, want 2", calls)
+	}
+	if len(errs) != 1 || errs[0].Error() != "temporary failure" {
+		t.Fatalf("errors = %v", errs)
+	}
+}
+
+func TestGinReceiveQueueFull(t *testing.T) {
+	cs, err := NewCallbackServer(testCallbackToken, testCallbackKey, testCallbackCorp,
+		CallbackAsync(1, 1), CallbackDedup(NewMemoryDedupStore(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, block := make(chan struct{}), make(chan struct{})
+	cs.HandleMsg(MsgTypeText, func(ctx context.Context, evt *Event) error {
+		if evt.MsgId == "1" {
+			close(started)
+		}
+		<-block
+		return nil
+	})
+	r := newTestGinEngine(cs)
+	post := func(msgID string) int {
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, newCallbackRequest(t, cs.MsgCrypt(), testTextMsg(msgID)))
+		return rw.Code
+	}
+
+	if code := post("1"); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	<-started
+	if code := post("2"); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if code := post("3"); code != http.StatusServiceUnavailable {
+		t.Fatalf("queue full: status = %d, want 503", code)
+	}
+	close(block)
+	if err = cs.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code := post("4"); code != http.StatusServiceUnavailable {
+		t.Fatalf("after shutdown: status = %d, want 503", code)
+	}
+}
@@ -0,0 +1,366 @@
+package wecom
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 接收回调：https://developer.work.weixin.qq.com/document/path/90930
+
+// maxCallbackBody 回调请求body的最大长度
+const maxCallbackBody = 1 << 20
+
+// EventKey 回调消息的路由标识，未使用的字段为空
+// 如成员变更事件为 {MsgType: "event", Event: "change_contact", ChangeType: "create_user"}
+type EventKey struct {
+	MsgType    string
+	Event      string
+	ChangeType string
+	JobType    string
+}
+
+// fallbacks 由具体到宽泛的匹配顺序：完整标识、去掉ChangeType/JobType、只保留MsgType
+func (k EventKey) fallbacks() []EventKey {
+	keys := []EventKey{k}
+	if k.ChangeType != "" || k.JobType != "" {
+		keys = append(keys, EventKey{MsgType: k.MsgType, Event: k.Event})
+	}
+	if k.Event != "" {
+		keys = append(keys, EventKey{MsgType: k.MsgType})
+	}
+	return keys
+}
+
+func (k EventKey) String() string {
+	s := k.MsgType
+	for _, v := range []string{k.Event, k.ChangeType, k.JobType} {
+		if v != "" {
+			s += "/" + v
+		}
+	}
+	return s
+}
+
+// Event 解密后的回调消息
+type Event struct {
+	CallbackEvent
+	Key  EventKey // 路由标识
+	Raw  []byte   // 解密后的xml明文
+	Data any      // 按类型解析的消息内容，未注册解析器的类型为nil
+
+	reply Reply
+}
+
+// Reply 设置被动回复，处理函数成功返回后加密响应给企业微信
+// 开启异步处理(CallbackAsync)时已提前响应，设置的回复会被忽略，需改为调用发送消息接口
+func (e *Event) Reply(r Reply) {
+	e.reply = r
+}
+
+// eventRoute 用于路由的字段
+type eventRoute struct {
+	MsgType    string `xml:"MsgType"`
+	Event      string `xml:"Event"`
+	ChangeType string `xml:"ChangeType"`
+	JobType    string `xml:"BatchJob>JobType"`
+}
+
+// EventParser 将回调明文解析为具体类型
+type EventParser func(raw []byte) (any, error)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = make(map[EventKey]EventParser)
+)
+
+// RegisterEventParser 注册回调消息的解析器，匹配规则与CallbackServer的路由一致
+// 已注册的解析器会被覆盖，可用于扩展包内未收录的消息类型
+func RegisterEventParser(key EventKey, p EventParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[key] = p
+}
+
+func lookupEventParser(key EventKey) EventParser {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	for _, k := range key.fallbacks() {
+		if p, ok := parsers[k]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// ParseCallback 解析回调明文，返回包含路由标识与具体类型内容的Event
+func ParseCallback(raw []byte) (*Event, error) {
+	var route eventRoute
+	err := xml.Unmarshal(raw, &route)
+	if err != nil {
+		return nil, err
+	}
+	evt := &Event{
+		Key: EventKey{
+			MsgType:    route.MsgType,
+			Event:      route.Event,
+			ChangeType: route.ChangeType,
+			JobType:    route.JobType,
+		},
+		Raw: raw,
+	}
+	err = xml.Unmarshal(raw, &evt.CallbackEvent)
+	if err != nil {
+		return nil, err
+	}
+	if p := lookupEventParser(evt.Key); p != nil {
+		evt.Data, err = p(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s callback: %w", evt.Key, err)
+		}
+	}
+	return evt, nil
+}
+
+// EventHandler 回调消息的处理函数，返回错误时响应500，企业微信会重试推送
+// 开启异步处理时返回错误会按CallbackRetry重试，仍失败时调用CallbackOnHandlerError设置的回调
+type EventHandler func(ctx context.Context, evt *Event) error
+
+// CallbackOption 回调服务配置项
+type CallbackOption func(*CallbackServer)
+
+// CallbackOnError 设置请求处理失败时的回调，可用于记录日志
+func CallbackOnError(fn func(r *http.Request, err error)) CallbackOption {
+	return func(s *CallbackServer) {
+		s.onError = fn
+	}
+}
+
+// CallbackServer 接收企业微信回调的http.Handler
+// GET请求校验签名并返回解密的echostr，POST请求校验签名、解密后按路由分发到注册的处理函数
+//
+//	cs, err := wecom.NewCallbackServer(token, encodingAESKey, corpID)
+//	cs.HandleChangeContact("create_user", func(ctx context.Context, evt *wecom.Event) error { ... })
+//	http.Handle("/wecom/callback", cs)
+type CallbackServer struct {
+	crypt    *MsgCrypt
+	mu       sync.RWMutex
+	handlers map[EventKey]EventHandler
+	onError  func(r *http.Request, err error)
+	dedup    DedupStore
+	dedupTTL time.Duration
+	dedupKey func(evt *Event) string
+
+	// 异步处理，见CallbackAsync
+	queue          chan *Event
+	queueMu        sync.RWMutex
+	closed         bool
+	workers        int
+	retries        int
+	retryDelay     time.Duration
+	onHandlerError func(evt *Event, err error)
+	workerCtx      context.Context
+	cancelWorkers  context.CancelFunc
+	workerWG       sync.WaitGroup
+}
+
+// NewCallbackServer 创建回调服务
+// token、encodingAESKey - 管理后台回调配置中的Token与EncodingAESKey
+// receiveID - 企业应用为corpid，第三方应用为suiteid
+func NewCallbackServer(token, encodingAESKey, receiveID string, opts ...CallbackOption) (*CallbackServer, error) {
+	crypt, err := NewMsgCrypt(token, encodingAESKey, receiveID)
+	if err != nil {
+		return nil, err
+	}
+	s := &CallbackServer{
+		crypt:      crypt,
+		handlers:   make(map[EventKey]EventHandler),
+		dedupTTL:   defaultDedupRetention,
+		dedupKey:   DedupKey,
+		retries:    defaultCallbackRetries,
+		retryDelay: defaultCallbackRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.dedupTTL <= 0 {
+		s.dedupTTL = defaultDedupRetention
+	}
+	if s.queue != nil {
+		s.startWorkers()
+	}
+	return s, nil
+}
+
+// MsgCrypt 返回回调服务使用的加解密工具
+func (s *CallbackServer) MsgCrypt() *MsgCrypt {
+	return s.crypt
+}
+
+// Handle 注册处理函数，消息按完整标识、{MsgType, Event}、{MsgType}、默认处理函数的顺序匹配
+func (s *CallbackServer) Handle(key EventKey, h EventHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[key] = h
+}
+
+// HandleMsg 注册用户消息的处理函数，如text、image
+func (s *CallbackServer) HandleMsg(msgType string, h EventHandler) {
+	s.Handle(EventKey{MsgType: msgType}, h)
+}
+
+// HandleEvent 注册事件的处理函数，如enter_agent、change_contact
+func (s *CallbackServer) HandleEvent(event string, h EventHandler) {
+	s.Handle(EventKey{MsgType: "event", Event: event}, h)
+}
+
+// HandleChangeContact 注册通讯录变更事件的处理函数，如create_user、update_tag
+func (s *CallbackServer) HandleChangeContact(changeType string, h EventHandler) {
+	s.Handle(EventKey{MsgType: "event", Event: "change_contact", ChangeType: changeType}, h)
+}
+
+// HandleBatchJob 注册异步任务完成事件的处理函数，如sync_user、export_user
+func (s *CallbackServer) HandleBatchJob(jobType string, h EventHandler) {
+	s.Handle(EventKey{MsgType: "event", Event: "batch_job_result", JobType: jobType}, h)
+}
+
+// HandleDefault 注册未匹配到处理函数的消息的默认处理函数
+func (s *CallbackServer) HandleDefault(h EventHandler) {
+	s.Handle(EventKey{}, h)
+}
+
+func (s *CallbackServer) handler(key EventKey) EventHandler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range append(key.fallbacks(), EventKey{}) {
+		if h, ok := s.handlers[k]; ok {
+			return h
+		}
+	}
+	return nil
+}
+
+func (s *CallbackServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.serveVerify(rw, r)
+	case http.MethodPost:
+		s.serveEvent(rw, r)
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// serveVerify 回调URL验证
+func (s *CallbackServer) serveVerify(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	echo, err := s.crypt.VerifyURL(q.Get("msg_signature"), q.Get("timestamp"), q.Get("nonce"), q.Get("echostr"))
+	if err != nil {
+		s.fail(rw, r, http.StatusBadRequest, err)
+		return
+	}
+	_, _ = rw.Write(echo)
+}
+
+func (s *CallbackServer) serveEvent(rw http.ResponseWriter, r *http.Request) {
+	evt, status, err := s.Decode(r)
+	if err != nil {
+		s.fail(rw, r, status, err)
+		return
+	}
+	first, err := s.acquire(r.Context(), evt)
+	if err != nil {
+		s.fail(rw, r, http.StatusInternalServerError, err)
+		return
+	}
+	if !first {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	if s.queue != nil {
+		err = s.enqueue(evt)
+		if err != nil {
+			s.release(r.Context(), evt)
+			s.fail(rw, r, http.StatusServiceUnavailable, err)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	err = s.Dispatch(r.Context(), evt)
+	if err != nil {
+		s.release(r.Context(), evt)
+		s.fail(rw, r, http.StatusInternalServerError, err)
+		return
+	}
+	if evt.reply == nil {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	b, err := s.encryptEventReply(r, evt)
+	if err != nil {
+		s.release(r.Context(), evt)
+		s.fail(rw, r, http.StatusInternalServerError, err)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	_, _ = rw.Write(b)
+}
+
+// encryptEventReply 生成并加密处理函数设置的被动回复
+func (s *CallbackServer) encryptEventReply(r *http.Request, evt *Event) ([]byte, error) {
+	msg, err := MarshalReply(&evt.CallbackEvent, evt.reply)
+	if err != nil {
+		return nil, err
+	}
+	return s.EncryptReply(r, msg)
+}
+
+// Decode 校验签名并解密回调请求，失败时同时返回应响应的http状态码
+func (s *CallbackServer) Decode(r *http.Request) (*Event, int, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBody+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(body) > maxCallbackBody {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("wecom: callback body too large")
+	}
+	q := r.URL.Query()
+	raw, err := s.crypt.DecryptMsg(q.Get("msg_signature"), q.Get("timestamp"), q.Get("nonce"), body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	evt, err := ParseCallback(raw)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return evt, http.StatusOK, nil
+}
+
+// EncryptReply 加密被动回复，使用回调请求中的timestamp与nonce
+func (s *CallbackServer) EncryptReply(r *http.Request, msg []byte) ([]byte, error) {
+	q := r.URL.Query()
+	return s.crypt.EncryptMsg(msg, q.Get("timestamp"), q.Get("nonce"))
+}
+
+// Dispatch 将消息分发到匹配的处理函数，没有匹配的处理函数时直接返回
+func (s *CallbackServer) Dispatch(ctx context.Context, evt *Event) error {
+	h := s.handler(evt.Key)
+	if h == nil {
+		return nil
+	}
+	return h(ctx, evt)
+}
+
+func (s *CallbackServer) fail(rw http.ResponseWriter, r *http.Request, status int, err error) {
+	if s.onError != nil {
+		s.onError(r, err)
+	}
+	http.Error(rw, http.StatusText(status), status)
+}
@@ -0,0 +1,423 @@
+package wecom
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// 以下xml取自企业微信文档中的示例
+// 通讯录回调通知：https://developer.work.weixin.qq.com/document/path/90970
+// 异步任务完成通知：https://developer.work.weixin.qq.com/document/path/90973
+// 接收消息：https://developer.work.weixin.qq.com/document/path/90239
+
+const sampleCreateUser = `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1403610513</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[change_contact]]></Event>
+	<ChangeType>create_user</ChangeType>
+	<UserID><![CDATA[zhangsan]]></UserID>
+	<Name><![CDATA[张三]]></Name>
+	<Department><![CDATA[1,2,3]]></Department>
+	<MainDepartment>1</MainDepartment>
+	<IsLeaderInDept><![CDATA[1,0,0]]></IsLeaderInDept>
+	<DirectLeader><![CDATA[lisi,wangwu]]></DirectLeader>
+	<Position><![CDATA[产品经理]]></Position>
+	<Mobile>13800000000</Mobile>
+	<Gender>1</Gender>
+	<BizMail><![CDATA[zhangsan@qyycs2.wecom.work]]></BizMail>
+	<Email><![CDATA[zhangsan@gzdev.com]]></Email>
+	<Status>1</Status>
+	<Avatar><![CDATA[http://wx.qlogo.cn/mmopen/ajNVdqHZLLA3WJ6DSZUfiakYe37PKnQhBIeOQBO4czqrnZDS79FH5Wm5m4X69TBicnHFlhiafvDwklOpZeXYQQ2icg/0]]></Avatar>
+	<Alias><![CDATA[zhangsan]]></Alias>
+	<Telephone><![CDATA[020-123456]]></Telephone>
+	<Address><![CDATA[广州市]]></Address>
+	<ExtAttr>
+		<Item>
+		<Name><![CDATA[爱好]]></Name>
+		<Type>0</Type>
+		<Text>
+			<Value><![CDATA[旅游]]></Value>
+		</Text>
+		</Item>
+		<Item>
+		<Name><![CDATA[卡号]]></Name>
+		<Type>1</Type>
+		<Web>
+			<Title><![CDATA[企业微信]]></Title>
+			<Url><![CDATA[https://work.weixin.qq.com]]></Url>
+		</Web>
+		</Item>
+	</ExtAttr>
+</xml>`
+
+const sampleUpdateUser = `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1403610513</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[change_contact]]></Event>
+	<ChangeType>update_user</ChangeType>
+	<UserID><![CDATA[zhangsan]]></UserID>
+	<NewUserID><![CDATA[zhangsan001]]></NewUserID>
+	<Name><![CDATA[张三]]></Name>
+	<Department><![CDATA[1,2,3]]></Department>
+	<MainDepartment>1</MainDepartment>
+	<IsLeaderInDept><![CDATA[1,0,0]]></IsLeaderInDept>
+	<Position><![CDATA[产品经理]]></Position>
+	<Mobile>13800000000</Mobile>
+	<Gender>1</Gender>
+	<Email><![CDATA[zhangsan@gzdev.com]]></Email>
+	<Status>1</Status>
+	<Alias><![CDATA[zhangsan]]></Alias>
+	<Telephone><![CDATA[020-123456]]></Telephone>
+</xml>`
+
+const sampleDeleteUser = `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1403610513</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[change_contact]]></Event>
+	<ChangeType>delete_user</ChangeType>
+	<UserID><![CDATA[zhangsan]]></UserID>
+</xml>`
+
+const sampleCreateParty = `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1403610513</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[change_contact]]></Event>
+	<ChangeType>create_party</ChangeType>
+	<Id>2</Id>
+	<Name><![CDATA[张三]]></Name>
+	<ParentId><![CDATA[1]]></ParentId>
+	<Order>1</Order>
+</xml>`
+
+const sampleUpdateParty = `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1403610513</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[change_contact]]></Event>
+	<ChangeType>update_party</ChangeType>
+	<Id>2</Id>
+	<Name><![CDATA[张三]]></Name>
+	<ParentId><![CDATA[1]]></ParentId>
+</xml>`
+
+const sampleDeleteParty = `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1403610513</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[change_contact]]></Event>
+	<ChangeType>delete_party</ChangeType>
+	<Id>2</Id>
+</xml>`
+
+const sampleUpdateTag = `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1403610513</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[change_contact]]></Event>
+	<ChangeType><![CDATA[update_tag]]></ChangeType>
+	<TagId>1</TagId>
+	<AddUserItems><![CDATA[zhangsan,lisi]]></AddUserItems>
+	<DelUserItems><![CDATA[zhangsan1,lisi1]]></DelUserItems>
+	<AddPartyItems><![CDATA[1,2]]></AddPartyItems>
+	<DelPartyItems><![CDATA[3,4]]></DelPartyItems>
+</xml>`
+
+func changeContactHeader(changeType string) CallbackEvent {
+	return CallbackEvent{
+		ToUserName:   "toUser",
+		FromUserName: "sys",
+		CreateTime:   1403610513,
+		MsgType:      "event",
+		Event:        "change_contact",
+		ChangeType:   changeType,
+	}
+}
+
+func TestParseChangeContact(t *testing.T) {
+	hobby := ContactExtAttrItem{Name: "爱好", Type: 0}
+	hobby.Text.Value = "旅游"
+	card := ContactExtAttrItem{Name: "卡号", Type: 1}
+	card.Web.Title = "企业微信"
+	card.Web.Url = "https://work.weixin.qq.com"
+
+	tests := []struct {
+		name string
+		xml  string
+		want any
+	}{
+		{"create_user", sampleCreateUser, &ContactUserEvent{
+			CallbackEvent:  changeContactHeader("create_user"),
+			UserID:         "zhangsan",
+			Name:           "张三",
+			Department:     CommaInts{1, 2, 3},
+			MainDepartment: 1,
+			IsLeaderInDept: CommaInts{1, 0, 0},
+			DirectLeader:   CommaStrings{"lisi", "wangwu"},
+			Position:       "产品经理",
+			Mobile:         "13800000000",
+			Gender:         "1",
+			Email:          "zhangsan@gzdev.com",
+			BizMail:        "zhangsan@qyycs2.wecom.work",
+			Status:         1,
+			Avatar:         "http://wx.qlogo.cn/mmopen/ajNVdqHZLLA3WJ6DSZUfiakYe37PKnQhBIeOQBO4czqrnZDS79FH5Wm5m4X69TBicnHFlhiafvDwklOpZeXYQQ2icg/0",
+			Alias:          "zhangsan",
+			Telephone:      "020-123456",
+			Address:        "广州市",
+			ExtAttr:        []ContactExtAttrItem{hobby, card},
+		}},
+		{"update_user", sampleUpdateUser, &ContactUserEvent{
+			CallbackEvent:  changeContactHeader("update_user"),
+			UserID:         "zhangsan",
+			NewUserID:      "zhangsan001",
+			Name:           "张三",
+			Department:     CommaInts{1, 2, 3},
+			MainDepartment: 1,
+			IsLeaderInDept: CommaInts{1, 0, 0},
+			Position:       "产品经理",
+			Mobile:         "13800000000",
+			Gender:         "1",
+			Email:          "zhangsan@gzdev.com",
+			Status:         1,
+			Alias:          "zhangsan",
+			Telephone:      "020-123456",
+		}},
+		{"delete_user", sampleDeleteUser, &ContactUserEvent{
+			CallbackEvent: changeContactHeader("delete_user"),
+			UserID:        "zhangsan",
+		}},
+		{"create_party", sampleCreateParty, &ContactPartyEvent{
+			CallbackEvent: changeContactHeader("create_party"),
+			Id:            2,
+			Name:          "张三",
+			ParentId:      1,
+			Order:         1,
+		}},
+		{"update_party", sampleUpdateParty, &ContactPartyEvent{
+			CallbackEvent: changeContactHeader("update_party"),
+			Id:            2,
+			Name:          "张三",
+			ParentId:      1,
+		}},
+		{"delete_party", sampleDeleteParty, &ContactPartyEvent{
+			CallbackEvent: changeContactHeader("delete_party"),
+			Id:            2,
+		}},
+		{"update_tag", sampleUpdateTag, &ContactTagEvent{
+			CallbackEvent: changeContactHeader("update_tag"),
+			TagId:         1,
+			AddUserItems:  CommaStrings{"zhangsan", "lisi"},
+			DelUserItems:  CommaStrings{"zhangsan1", "lisi1"},
+			AddPartyItems: CommaInts{1, 2},
+			DelPartyItems: CommaInts{3, 4},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt, err := ParseCallback([]byte(tt.xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := EventKey{MsgType: "event", Event: "change_contact", ChangeType: tt.name}
+			if evt.Key != want {
+				t.Errorf("Key = %+v, want %+v", evt.Key, want)
+			}
+			assertParsed(t, evt.Data, tt.want)
+		})
+	}
+}
+
+func TestParseBatchJobEvent(t *testing.T) {
+	sample := func(jobType string, errcode int, errmsg string) string {
+		return `<xml>
+	<ToUserName><![CDATA[wx28dbb14e3720FAKE]]></ToUserName>
+	<FromUserName><![CDATA[sys]]></FromUserName>
+	<CreateTime>1425284517</CreateTime>
+	<MsgType><![CDATA[event]]></MsgType>
+	<Event><![CDATA[batch_job_result]]></Event>
+	<BatchJob>
+		<JobId><![CDATA[S0MrnndvRG5fadSlLwiBqiDDbM143UqTmKP3152FZk4]]></JobId>
+		<JobType><![CDATA[` + jobType + `]]></JobType>
+		<ErrCode>` + strconv.Itoa(errcode) + `</ErrCode>
+		<ErrMsg><![CDATA[` + errmsg + `]]></ErrMsg>
+	</BatchJob>
+</xml>`
+	}
+	tests := []struct {
+		jobType string
+		errcode int
+		errmsg  string
+		export  bool
+	}{
+		{JobTypeSyncUser, 0, "ok", false},
+		{JobTypeReplaceUser, 0, "ok", false},
+		{JobTypeInviteUser, 0, "ok", false},
+		{JobTypeReplaceParty, 60123, "invalid party id", false},
+		{JobTypeExportUser, 0, "ok", true},
+		{JobTypeExportSimpleUser, 0, "ok", true},
+		{JobTypeExportDepartment, 0, "ok", true},
+		{JobTypeExportTagUser, 0, "ok", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jobType, func(t *testing.T) {
+			evt, err := ParseCallback([]byte(sample(tt.jobType, tt.errcode, tt.errmsg)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := EventKey{MsgType: "event", Event: "batch_job_result", JobType: tt.jobType}
+			if evt.Key != want {
+				t.Errorf("Key = %+v, want %+v", evt.Key, want)
+			}
+			assertParsed(t, evt.Data, &BatchJobEvent{
+				CallbackEvent: CallbackEvent{
+					ToUserName:   "wx28dbb14e3720FAKE",
+					FromUserName: "sys",
+					CreateTime:   1425284517,
+					MsgType:      "event",
+					Event:        "batch_job_result",
+				},
+				BatchJob: BatchJob{
+					JobId:   "S0MrnndvRG5fadSlLwiBqiDDbM143UqTmKP3152FZk4",
+					JobType: tt.jobType,
+					Error:   Error{Errcode: tt.errcode, Errmsg: tt.errmsg},
+				},
+			})
+			job, err := ParseBatchJob([]byte(sample(tt.jobType, tt.errcode, tt.errmsg)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.IsExport() != tt.export {
+				t.Errorf("IsExport() = %v, want %v", job.IsExport(), tt.export)
+			}
+			if (job.Check() != nil) != (tt.errcode != 0) {
+				t.Errorf("Check() = %v", job.Check())
+			}
+		})
+	}
+
+	_, err := ParseBatchJobEvent([]byte(`<xml><MsgType>event</MsgType><Event>batch_job_result</Event></xml>`))
+	if err == nil {
+		t.Error("expected error for missing BatchJob")
+	}
+}
+
+func TestParseUserMsg(t *testing.T) {
+	header := func(msgType string) UserMsg {
+		return UserMsg{
+			CallbackEvent: CallbackEvent{
+				ToUserName:   "toUser",
+				FromUserName: "fromUser",
+				CreateTime:   1348831860,
+				MsgType:      msgType,
+				MsgId:        "1234567890123456",
+			},
+			AgentID: 1,
+		}
+	}
+	tests := []struct {
+		name string
+		xml  string
+		want any
+	}{
+		{MsgTypeText, `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[text]]></MsgType>
+	<Content><![CDATA[this is a test]]></Content>
+	<MsgId>1234567890123456</MsgId>
+	<AgentID>1</AgentID>
+</xml>`, &TextMsg{UserMsg: header(MsgTypeText), Content: "this is a test"}},
+		{MsgTypeImage, `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[image]]></MsgType>
+	<PicUrl><![CDATA[this is a url]]></PicUrl>
+	<MediaId><![CDATA[media_id]]></MediaId>
+	<MsgId>1234567890123456</MsgId>
+	<AgentID>1</AgentID>
+</xml>`, &ImageMsg{UserMsg: header(MsgTypeImage), PicUrl: "this is a url", MediaId: "media_id"}},
+		{MsgTypeVoice, `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[voice]]></MsgType>
+	<MediaId><![CDATA[media_id]]></MediaId>
+	<Format><![CDATA[Format]]></Format>
+	<MsgId>1234567890123456</MsgId>
+	<AgentID>1</AgentID>
+</xml>`, &VoiceMsg{UserMsg: header(MsgTypeVoice), MediaId: "media_id", Format: "Format"}},
+		{MsgTypeVideo, `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[video]]></MsgType>
+	<MediaId><![CDATA[media_id]]></MediaId>
+	<ThumbMediaId><![CDATA[thumb_media_id]]></ThumbMediaId>
+	<MsgId>1234567890123456</MsgId>
+	<AgentID>1</AgentID>
+</xml>`, &VideoMsg{UserMsg: header(MsgTypeVideo), MediaId: "media_id", ThumbMediaId: "thumb_media_id"}},
+		{MsgTypeLocation, `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[location]]></MsgType>
+	<Location_X>23.134521</Location_X>
+	<Location_Y>113.358803</Location_Y>
+	<Scale>20</Scale>
+	<Label><![CDATA[位置信息]]></Label>
+	<MsgId>1234567890123456</MsgId>
+	<AgentID>1</AgentID>
+	<AppType><![CDATA[wxwork]]></AppType>
+</xml>`, &LocationMsg{UserMsg: header(MsgTypeLocation), LocationX: 23.134521, LocationY: 113.358803, Scale: 20, Label: "位置信息", AppType: "wxwork"}},
+		{MsgTypeLink, `<xml>
+	<ToUserName><![CDATA[toUser]]></ToUserName>
+	<FromUserName><![CDATA[fromUser]]></FromUserName>
+	<CreateTime>1348831860</CreateTime>
+	<MsgType><![CDATA[link]]></MsgType>
+	<Title><![CDATA[this is a title!]]></Title>
+	<Description><![CDATA[this is a description!]]></Description>
+	<Url><![CDATA[URL]]></Url>
+	<PicUrl><![CDATA[this is a url]]></PicUrl>
+	<MsgId>1234567890123456</MsgId>
+	<AgentID>1</AgentID>
+</xml>`, &LinkMsg{UserMsg: header(MsgTypeLink), Title: "this is a title!", Description: "this is a description!", Url: "URL", PicUrl: "this is a url"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt, err := ParseCallback([]byte(tt.xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if evt.Key != (EventKey{MsgType: tt.name}) {
+				t.Errorf("Key = %+v", evt.Key)
+			}
+			if DedupKey(evt) != "msg:1234567890123456" {
+				t.Errorf("DedupKey = %q", DedupKey(evt))
+			}
+			assertParsed(t, evt.Data, tt.want)
+		})
+	}
+}
+
+func assertParsed(t *testing.T, got, want any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		gb, _ := json.Marshal(got)
+		wb, _ := json.Marshal(want)
+		t.Errorf("got  %T %s\nwant %T %s", got, gb, want, wb)
+	}
+}
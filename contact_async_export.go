@@ -8,6 +8,7 @@ package wecom
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"errors"
@@ -15,27 +16,33 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
-	"strings"
 )
 
+// exportDownloadPath 下载导出文件时中间件中的CallInfo.Path，下载地址不属于企业微信的接口，不经过限流器
+const exportDownloadPath = "export/download"
+
 // AsyncExportUser 导出成员
 // AESKey=Base64_Decode(encoding_aeskey + “=”)
 // aeskey - (必选)用于解密结果的aeskey
 // blockSize - 10^4 ~ 10^6之间，默认10^6
 func (w *Wecom) AsyncExportUser(aeskey string, blockSize ...int) (string, error) {
-	var a = map[string]string{
+	return w.AsyncExportUserContext(context.Background(), aeskey, blockSize...)
+}
+
+// AsyncExportUserContext 同AsyncExportUser，支持通过ctx取消请求或设置超时
+func (w *Wecom) AsyncExportUserContext(ctx context.Context, aeskey string, blockSize ...int) (string, error) {
+	var a = map[string]any{
 		"encoding_aeskey": base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(aeskey)),
 	}
 	if len(blockSize) > 0 {
-		a["block_size"] = strconv.Itoa(blockSize[0])
+		a["block_size"] = blockSize[0]
 	}
-	body, err := w.post("export/simple_user", a)
+	var r jobResult
+	err := w.post(ctx, "export/simple_user", a, &r)
 	if err != nil {
 		return "", err
 	}
-	jobid := strings.Trim(string(body["jobid"]), `"`)
-	return jobid, nil
+	return r.JobID, nil
 }
 
 // AsyncExportUserDetail 导出成员详细信息
@@ -43,18 +50,23 @@ func (w *Wecom) AsyncExportUser(aeskey string, blockSize ...int) (string, error)
 // aeskey - (必选)用于解密结果的aeskey
 // blockSize - 10^4 ~ 10^6之间，默认10^6
 func (w *Wecom) AsyncExportUserDetail(aeskey string, blockSize ...int) (string, error) {
-	var a = map[string]string{
+	return w.AsyncExportUserDetailContext(context.Background(), aeskey, blockSize...)
+}
+
+// AsyncExportUserDetailContext 同AsyncExportUserDetail，支持通过ctx取消请求或设置超时
+func (w *Wecom) AsyncExportUserDetailContext(ctx context.Context, aeskey string, blockSize ...int) (string, error) {
+	var a = map[string]any{
 		"encoding_aeskey": base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(aeskey)),
 	}
 	if len(blockSize) > 0 {
-		a["block_size"] = strconv.Itoa(blockSize[0])
+		a["block_size"] = blockSize[0]
 	}
-	body, err := w.post("export/user", a)
+	var r jobResult
+	err := w.post(ctx, "export/user", a, &r)
 	if err != nil {
 		return "", err
 	}
-	jobid := strings.Trim(string(body["jobid"]), `"`)
-	return jobid, nil
+	return r.JobID, nil
 }
 
 // AsyncExportDepartment 导出部门
@@ -62,18 +74,23 @@ func (w *Wecom) AsyncExportUserDetail(aeskey string, blockSize ...int) (string,
 // aeskey - (必选)用于解密结果的aeskey
 // blockSize - 10^4 ~ 10^6之间，默认10^6
 func (w *Wecom) AsyncExportDepartment(aeskey string, blockSize ...int) (string, error) {
-	var a = map[string]string{
+	return w.AsyncExportDepartmentContext(context.Background(), aeskey, blockSize...)
+}
+
+// AsyncExportDepartmentContext 同AsyncExportDepartment，支持通过ctx取消请求或设置超时
+func (w *Wecom) AsyncExportDepartmentContext(ctx context.Context, aeskey string, blockSize ...int) (string, error) {
+	var a = map[string]any{
 		"encoding_aeskey": base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(aeskey)),
 	}
 	if len(blockSize) > 0 {
-		a["block_size"] = strconv.Itoa(blockSize[0])
+		a["block_size"] = blockSize[0]
 	}
-	body, err := w.post("export/department", a)
+	var r jobResult
+	err := w.post(ctx, "export/department", a, &r)
 	if err != nil {
 		return "", err
 	}
-	jobid := strings.Trim(string(body["jobid"]), `"`)
-	return jobid, nil
+	return r.JobID, nil
 }
 
 // AsyncExportTagMember 导出标签成员
@@ -81,37 +98,46 @@ func (w *Wecom) AsyncExportDepartment(aeskey string, blockSize ...int) (string,
 // aeskey - (必选)用于解密结果的aeskey
 // blockSize - 10^4 ~ 10^6之间，默认10^6
 // tagid - 标签id
-func (w *Wecom) AsyncExportTagMember(tagid, aeskey string, blockSize ...int) (string, error) {
-	var a = map[string]string{
+func (w *Wecom) AsyncExportTagMember(tagid int, aeskey string, blockSize ...int) (string, error) {
+	return w.AsyncExportTagMemberContext(context.Background(), tagid, aeskey, blockSize...)
+}
+
+// AsyncExportTagMemberContext 同AsyncExportTagMember，支持通过ctx取消请求或设置超时
+func (w *Wecom) AsyncExportTagMemberContext(ctx context.Context, tagid int, aeskey string, blockSize ...int) (string, error) {
+	var a = map[string]any{
 		"encoding_aeskey": base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(aeskey)),
 		"tagid":           tagid,
 	}
 	if len(blockSize) > 0 {
-		a["block_size"] = strconv.Itoa(blockSize[0])
+		a["block_size"] = blockSize[0]
 	}
-	body, err := w.post("export/taguser", a)
+	var r jobResult
+	err := w.post(ctx, "export/taguser", a, &r)
 	if err != nil {
 		return "", err
 	}
-	jobid := strings.Trim(string(body["jobid"]), `"`)
-	return jobid, nil
+	return r.JobID, nil
 }
 
 // AsyncExportGetResult 根据jobid，获取导出任务结果
 // 结果导出后，还需要下载导出文件
 func (w *Wecom) AsyncExportGetResult(jobid string) (*ExportResult, error) {
+	return w.AsyncExportGetResultContext(context.Background(), jobid)
+}
+
+// AsyncExportGetResultContext 同AsyncExportGetResult，支持通过ctx取消请求或设置超时
+func (w *Wecom) AsyncExportGetResultContext(ctx context.Context, jobid string) (*ExportResult, error) {
 	query := url.Values{}
 	query.Add("jobid", jobid)
-	body, err := w.get("export/get_result", query)
-	if err != nil {
-		return nil, err
+	var r struct {
+		Error
+		ExportResult
 	}
-	var r ExportResult
-	err = umarshalObject(body, &r)
+	err := w.get(ctx, "export/get_result", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	return &r, nil
+	return &r.ExportResult, nil
 }
 
 // AsyncExportDownloadResult 从导出结果的url中下载并解密数据
@@ -121,14 +147,27 @@ func (w *Wecom) AsyncExportGetResult(jobid string) (*ExportResult, error) {
 // 2:部门信息 - []Department
 // 3:标签成员信息 - *TagMemberList
 func (w *Wecom) AsyncExportDownloadResult(aeskey string, dataUrl ExportUrl) ([]byte, error) {
-	resp, err := http.Get(dataUrl.Url)
+	return w.AsyncExportDownloadResultContext(context.Background(), aeskey, dataUrl)
+}
+
+// AsyncExportDownloadResultContext 同AsyncExportDownloadResult，支持通过ctx取消请求或设置超时
+func (w *Wecom) AsyncExportDownloadResultContext(ctx context.Context, aeskey string, dataUrl ExportUrl) ([]byte, error) {
+	req, err := w.newRawRequest(ctx, http.MethodGet, dataUrl.Url, nil)
 	if err != nil {
 		return nil, err
 	}
-	body, err := io.ReadAll(resp.Body)
+	call := &CallInfo{
+		Method:  http.MethodGet,
+		Path:    exportDownloadPath,
+		Attempt: 1,
+		Request: req,
+		raw:     true,
+	}
+	err = w.invoker(ctx, call)
 	if err != nil {
 		return nil, err
 	}
+	body := call.ResponseBody
 	m := md5.New()
 	n, err := io.Copy(m, bytes.NewBuffer(body))
 	if err != nil {
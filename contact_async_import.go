@@ -8,55 +8,78 @@
 package wecom
 
 import (
+	"context"
 	"net/url"
 )
 
 // SyncImportUpdateUser 增量更新成员
 // https://developer.work.weixin.qq.com/document/path/90980
 func (w *Wecom) SyncImportUpdateUser(syncImport Import) (string, error) {
-	body, err := w.post("batch/syncuser", syncImport)
+	return w.SyncImportUpdateUserContext(context.Background(), syncImport)
+}
+
+// SyncImportUpdateUserContext 同SyncImportUpdateUser，支持通过ctx取消请求或设置超时
+func (w *Wecom) SyncImportUpdateUserContext(ctx context.Context, syncImport Import) (string, error) {
+	var r jobResult
+	err := w.post(ctx, "batch/syncuser", syncImport, &r)
 	if err != nil {
 		return "", err
 	}
-	return string(body["jobid"]), nil
+	return r.JobID, nil
 }
 
 // SyncImportReplaceUser 全量覆盖成员
 // https://developer.work.weixin.qq.com/document/path/90981
 func (w *Wecom) SyncImportReplaceUser(syncImport Import) (string, error) {
-	body, err := w.post("batch/replaceuser", syncImport)
+	return w.SyncImportReplaceUserContext(context.Background(), syncImport)
+}
+
+// SyncImportReplaceUserContext 同SyncImportReplaceUser，支持通过ctx取消请求或设置超时
+func (w *Wecom) SyncImportReplaceUserContext(ctx context.Context, syncImport Import) (string, error) {
+	var r jobResult
+	err := w.post(ctx, "batch/replaceuser", syncImport, &r)
 	if err != nil {
 		return "", err
 	}
-	return string(body["jobid"]), nil
+	return r.JobID, nil
 }
 
 // SyncImportReplaceParty 全量覆盖部门
 // https://developer.work.weixin.qq.com/document/path/90982
 // 接口会忽略to_invite字段
 func (w *Wecom) SyncImportReplaceParty(syncImport Import) (string, error) {
+	return w.SyncImportReplacePartyContext(context.Background(), syncImport)
+}
+
+// SyncImportReplacePartyContext 同SyncImportReplaceParty，支持通过ctx取消请求或设置超时
+func (w *Wecom) SyncImportReplacePartyContext(ctx context.Context, syncImport Import) (string, error) {
 	syncImport.ToInvite = false
-	body, err := w.post("batch/replaceparty", syncImport)
+	var r jobResult
+	err := w.post(ctx, "batch/replaceparty", syncImport, &r)
 	if err != nil {
 		return "", err
 	}
-	return string(body["jobid"]), nil
+	return r.JobID, nil
 }
 
 // SyncImportGetResult 查询提交过的历史任务
 // https://developer.work.weixin.qq.com/document/path/90983
 // 返回值中的result字段，有两种可能性：[]SyncImportUserResult, []SyncImportPartyResult
 func (w *Wecom) SyncImportGetResult(jobid string) (*ImportResult, error) {
+	return w.SyncImportGetResultContext(context.Background(), jobid)
+}
+
+// SyncImportGetResultContext 同SyncImportGetResult，支持通过ctx取消请求或设置超时
+func (w *Wecom) SyncImportGetResultContext(ctx context.Context, jobid string) (*ImportResult, error) {
 	query := url.Values{}
 	query.Add("jobid", jobid)
-	body, err := w.get("batch/getresult", query)
-	if err != nil {
-		return nil, err
+	var r struct {
+		Error
+		ImportResult
 	}
-	var r ImportResult
-	err = umarshalObject(body, &r)
+	err := w.get(ctx, "batch/getresult", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	return &r, nil
+	return &r.ImportResult, nil
 }
@@ -3,8 +3,7 @@
 package wecom
 
 import (
-	"encoding/binary"
-	"encoding/json"
+	"context"
 	"net/url"
 	"strconv"
 )
@@ -14,68 +13,94 @@ import (
 // - 必须携带： name, parentid(根部门id为1)
 // - 可选携带id，若不填则自动生成
 func (w *Wecom) DepartmentCreate(dpmt Department) (int, error) {
-	body, err := w.post("department/create", dpmt)
+	return w.DepartmentCreateContext(context.Background(), dpmt)
+}
+
+// DepartmentCreateContext 同DepartmentCreate，支持通过ctx取消请求或设置超时
+func (w *Wecom) DepartmentCreateContext(ctx context.Context, dpmt Department) (int, error) {
+	var r struct {
+		Error
+		Id int `json:"id"`
+	}
+	err := w.post(ctx, "department/create", dpmt, &r)
 	if err != nil {
 		return 0, err
 	}
-	return int(binary.BigEndian.Uint32(body["id"])), nil
+	return r.Id, nil
 }
 
 // DepartmentUpdate 更新部门
 // https://developer.work.weixin.qq.com/document/path/90206
 // - 必须携带：id
 func (w *Wecom) DepartmentUpdate(dpmt Department) error {
-	_, err := w.post("department/update", dpmt)
-	return err
+	return w.DepartmentUpdateContext(context.Background(), dpmt)
+}
+
+// DepartmentUpdateContext 同DepartmentUpdate，支持通过ctx取消请求或设置超时
+func (w *Wecom) DepartmentUpdateContext(ctx context.Context, dpmt Department) error {
+	return w.post(ctx, "department/update", dpmt, nil)
 }
 
 // DepartmentDelete 删除部门
 // https://developer.work.weixin.qq.com/document/path/90207
 func (w *Wecom) DepartmentDelete(id int) error {
+	return w.DepartmentDeleteContext(context.Background(), id)
+}
+
+// DepartmentDeleteContext 同DepartmentDelete，支持通过ctx取消请求或设置超时
+func (w *Wecom) DepartmentDeleteContext(ctx context.Context, id int) error {
 	var query = url.Values{}
 	query.Add("id", strconv.Itoa(id))
-	_, err := w.get("department/delete", query)
+	err := w.get(ctx, "department/delete", query, nil)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// DepartmentListGet 获取单个部门详情
+// DepartmentGet 获取单个部门详情
 // https://developer.work.weixin.qq.com/document/path/95351
 func (w *Wecom) DepartmentGet(id int) (*Department, error) {
+	return w.DepartmentGetContext(context.Background(), id)
+}
+
+// DepartmentGetContext 同DepartmentGet，支持通过ctx取消请求或设置超时
+func (w *Wecom) DepartmentGetContext(ctx context.Context, id int) (*Department, error) {
 	var query = url.Values{}
 	query.Add("id", strconv.Itoa(id))
-	body, err := w.get("department/delete", query)
-	if err != nil {
-		return nil, err
+	var r struct {
+		Error
+		Department Department `json:"department"`
 	}
-	var r Department
-	err = json.Unmarshal(body["department"], &r)
+	err := w.get(ctx, "department/get", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	return &r, nil
+	return &r.Department, nil
 }
 
 // DepartmentListGet 获取部门列表
 // https://developer.work.weixin.qq.com/document/path/90208
 // id - 部门ID，如果传入，则获取id对应部门及其下属部门列表;否则获取全量组织架构
 func (w *Wecom) DepartmentListGet(id ...int) ([]Department, error) {
+	return w.DepartmentListGetContext(context.Background(), id...)
+}
+
+// DepartmentListGetContext 同DepartmentListGet，支持通过ctx取消请求或设置超时
+func (w *Wecom) DepartmentListGetContext(ctx context.Context, id ...int) ([]Department, error) {
 	var query = url.Values{}
 	if len(id) > 0 {
 		query.Add("id", strconv.Itoa(id[0]))
 	}
-	b, err := w.get("department/list", query)
-	if err != nil {
-		return nil, err
+	var r struct {
+		Error
+		Department []Department `json:"department"`
 	}
-	var r []Department
-	err = json.Unmarshal(b["department"], &r)
+	err := w.get(ctx, "department/list", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	return r, nil
+	return r.Department, nil
 }
 
 // DepartmentSubIDListGet 获取子部门ID列表
@@ -83,18 +108,22 @@ func (w *Wecom) DepartmentListGet(id ...int) ([]Department, error) {
 // id - 部门id。获取指定部门及其下的子部门（以及子部门的子部门等等，递归）。 如果不填，默认获取全量组织架构
 // 返回值中只会包含 id、parentid、order字段
 func (w *Wecom) DepartmentSubIDListGet(id ...int) ([]Department, error) {
+	return w.DepartmentSubIDListGetContext(context.Background(), id...)
+}
+
+// DepartmentSubIDListGetContext 同DepartmentSubIDListGet，支持通过ctx取消请求或设置超时
+func (w *Wecom) DepartmentSubIDListGetContext(ctx context.Context, id ...int) ([]Department, error) {
 	var query = url.Values{}
 	if len(id) > 0 {
 		query.Add("id", strconv.Itoa(id[0]))
 	}
-	b, err := w.get("department/simplelist", query)
-	if err != nil {
-		return nil, err
+	var r struct {
+		Error
+		DepartmentID []Department `json:"department_id"`
 	}
-	var r []Department
-	err = json.Unmarshal(b["department_id"], &r)
+	err := w.get(ctx, "department/simplelist", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	return r, nil
+	return r.DepartmentID, nil
 }
@@ -3,8 +3,7 @@
 package wecom
 
 import (
-	"encoding/binary"
-	"encoding/json"
+	"context"
 	"net/url"
 	"strconv"
 )
@@ -17,27 +16,41 @@ import (
 // tagid - 可选，非负id整数
 // 返回：tagid或错误
 func (w *Wecom) TagCreate(tagname string, tagid ...int) (int, error) {
-	var a = map[string]string{
+	return w.TagCreateContext(context.Background(), tagname, tagid...)
+}
+
+// TagCreateContext 同TagCreate，支持通过ctx取消请求或设置超时
+func (w *Wecom) TagCreateContext(ctx context.Context, tagname string, tagid ...int) (int, error) {
+	var a = map[string]any{
 		"tagname": tagname,
 	}
 	if len(tagid) > 0 {
-		a["tagid"] = strconv.Itoa(tagid[0])
+		a["tagid"] = tagid[0]
+	}
+	var r struct {
+		Error
+		TagId int `json:"tagid"`
 	}
-	body, err := w.post("tag/create", a)
+	err := w.post(ctx, "tag/create", a, &r)
 	if err != nil {
 		return 0, err
 	}
-	return int(binary.BigEndian.Uint32(body["tagid"])), nil
+	return r.TagId, nil
 }
 
 // TagUpdate 更新标签名字
 // https://developer.work.weixin.qq.com/document/path/90211
 func (w *Wecom) TagUpdate(tagname string, tagid int) error {
-	var a = map[string]string{
-		"tagid":   strconv.Itoa(tagid),
+	return w.TagUpdateContext(context.Background(), tagname, tagid)
+}
+
+// TagUpdateContext 同TagUpdate，支持通过ctx取消请求或设置超时
+func (w *Wecom) TagUpdateContext(ctx context.Context, tagname string, tagid int) error {
+	var a = map[string]any{
+		"tagid":   tagid,
 		"tagname": tagname,
 	}
-	_, err := w.post("tag/update", a)
+	err := w.post(ctx, "tag/update", a, nil)
 	if err != nil {
 		return err
 	}
@@ -47,9 +60,14 @@ func (w *Wecom) TagUpdate(tagname string, tagid int) error {
 // TagDelete 删除标签
 // https://developer.work.weixin.qq.com/document/path/90212
 func (w *Wecom) TagDelete(tagid int) error {
+	return w.TagDeleteContext(context.Background(), tagid)
+}
+
+// TagDeleteContext 同TagDelete，支持通过ctx取消请求或设置超时
+func (w *Wecom) TagDeleteContext(ctx context.Context, tagid int) error {
 	var query = url.Values{}
 	query.Add("tagid", strconv.Itoa(tagid))
-	_, err := w.get("tag/delete", query)
+	err := w.get(ctx, "tag/delete", query, nil)
 	if err != nil {
 		return err
 	}
@@ -60,26 +78,22 @@ func (w *Wecom) TagDelete(tagid int) error {
 // https://developer.work.weixin.qq.com/document/path/90213
 // 返回标签名、标签中包含的部门ID列表、用户列表、错误
 func (w *Wecom) TagGetUser(tagid int) (string, []int, []User, error) {
+	return w.TagGetUserContext(context.Background(), tagid)
+}
+
+// TagGetUserContext 同TagGetUser，支持通过ctx取消请求或设置超时
+func (w *Wecom) TagGetUserContext(ctx context.Context, tagid int) (string, []int, []User, error) {
 	var query = url.Values{}
 	query.Add("tagid", strconv.Itoa(tagid))
-	b, err := w.get("tag/get", query)
-	if err != nil {
-		return "", nil, nil, err
-	}
-	tagname := string(b["tagname"])
-	partyList := b["partylist"]
-	userlistBoby := b["userlist"]
-	var plist []int
-	var userList []User
-	err = json.Unmarshal(partyList, &plist)
-	if err != nil {
-		return "", nil, nil, err
+	var r struct {
+		Error
+		TagMemberList
 	}
-	err = json.Unmarshal(userlistBoby, &userList)
+	err := w.get(ctx, "tag/get", query, &r)
 	if err != nil {
 		return "", nil, nil, err
 	}
-	return tagname, plist, userList, nil
+	return r.TagName, r.PartyList, r.UserList, nil
 }
 
 // TagAddUsers 添加标签成员
@@ -91,6 +105,11 @@ func (w *Wecom) TagGetUser(tagid int) (string, []int, []User, error) {
 // invalidparty - 失败的部门id，[2,4]
 // error - 如果非空，则整体失败
 func (w *Wecom) TagAddUsers(tagid int, userlist []string, partylist []int) (string, []int, error) {
+	return w.TagAddUsersContext(context.Background(), tagid, userlist, partylist)
+}
+
+// TagAddUsersContext 同TagAddUsers，支持通过ctx取消请求或设置超时
+func (w *Wecom) TagAddUsersContext(ctx context.Context, tagid int, userlist []string, partylist []int) (string, []int, error) {
 	var a = map[string]any{
 		"tagid": tagid,
 	}
@@ -100,18 +119,12 @@ func (w *Wecom) TagAddUsers(tagid int, userlist []string, partylist []int) (stri
 	if len(partylist) > 0 {
 		a["partylist"] = partylist
 	}
-	body, err := w.post("tag/addtagusers", a)
-	if err != nil {
-		return "", nil, err
-	}
-	invalidList := string(body["invalidlist"])
-	invalidpartyBytes := body["invalidparty"]
-	var invalidparty []int
-	err = json.Unmarshal(invalidpartyBytes, &invalidparty)
+	var r tagUsersResult
+	err := w.post(ctx, "tag/addtagusers", a, &r)
 	if err != nil {
 		return "", nil, err
 	}
-	return invalidList, invalidparty, nil
+	return r.InvalidList, r.InvalidParty, nil
 }
 
 // TagDelUsers 删除标签成员
@@ -123,6 +136,11 @@ func (w *Wecom) TagAddUsers(tagid int, userlist []string, partylist []int) (stri
 // invalidparty - 失败的部门id，[2,4]
 // error - 如果非空，则整体失败
 func (w *Wecom) TagDelUsers(tagid int, userlist []string, partylist []int) (string, []int, error) {
+	return w.TagDelUsersContext(context.Background(), tagid, userlist, partylist)
+}
+
+// TagDelUsersContext 同TagDelUsers，支持通过ctx取消请求或设置超时
+func (w *Wecom) TagDelUsersContext(ctx context.Context, tagid int, userlist []string, partylist []int) (string, []int, error) {
 	var a = map[string]any{
 		"tagid": tagid,
 	}
@@ -132,32 +150,36 @@ func (w *Wecom) TagDelUsers(tagid int, userlist []string, partylist []int) (stri
 	if len(partylist) > 0 {
 		a["partylist"] = partylist
 	}
-	body, err := w.post("tag/deltagusers", a)
-	if err != nil {
-		return "", nil, err
-	}
-	invalidList := string(body["invalidlist"])
-	invalidpartyBytes := body["invalidparty"]
-	var invalidparty []int
-	err = json.Unmarshal(invalidpartyBytes, &invalidparty)
+	var r tagUsersResult
+	err := w.post(ctx, "tag/deltagusers", a, &r)
 	if err != nil {
 		return "", nil, err
 	}
-	return invalidList, invalidparty, nil
+	return r.InvalidList, r.InvalidParty, nil
 }
 
 // TagList 获取标签列表
 // https://developer.work.weixin.qq.com/document/path/90216
 func (w *Wecom) TagList() ([]Tag, error) {
-	body, err := w.get("tag/list", nil)
-	if err != nil {
-		return nil, err
+	return w.TagListContext(context.Background())
+}
+
+// TagListContext 同TagList，支持通过ctx取消请求或设置超时
+func (w *Wecom) TagListContext(ctx context.Context) ([]Tag, error) {
+	var r struct {
+		Error
+		TagList []Tag `json:"taglist"`
 	}
-	taglistBytes := body["taglist"]
-	var taglist []Tag
-	err = json.Unmarshal(taglistBytes, &taglist)
+	err := w.get(ctx, "tag/list", nil, &r)
 	if err != nil {
 		return nil, err
 	}
-	return taglist, nil
+	return r.TagList, nil
+}
+
+// tagUsersResult 增删标签成员的结果
+type tagUsersResult struct {
+	Error
+	InvalidList  string `json:"invalidlist"`  // 失败的用户id，"usr1|usr2|usr"
+	InvalidParty []int  `json:"invalidparty"` // 失败的部门id
 }
@@ -3,7 +3,7 @@
 package wecom
 
 import (
-	"encoding/json"
+	"context"
 	"net/url"
 	"strconv"
 )
@@ -14,7 +14,12 @@ import (
 // 如果有extattr，则必须传：type name text.value
 // 如果有extattr，则必须传：web.url web.title
 func (w *Wecom) UserCreate(user User) error {
-	_, err := w.post("user/create", user)
+	return w.UserCreateContext(context.Background(), user)
+}
+
+// UserCreateContext 同UserCreate，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserCreateContext(ctx context.Context, user User) error {
+	err := w.post(ctx, "user/create", user, nil)
 	if err != nil {
 		return err
 	}
@@ -24,18 +29,22 @@ func (w *Wecom) UserCreate(user User) error {
 // UserGet 读取成员，根据userid查询成员详细信息
 // https://developer.work.weixin.qq.com/document/path/90196
 func (w *Wecom) UserGet(userid string) (*User, error) {
+	return w.UserGetContext(context.Background(), userid)
+}
+
+// UserGetContext 同UserGet，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserGetContext(ctx context.Context, userid string) (*User, error) {
 	var query = url.Values{}
 	query.Add("userid", userid)
-	body, err := w.get("user/get", query)
-	if err != nil {
-		return nil, err
+	var r struct {
+		Error
+		User
 	}
-	var r User
-	err = umarshalObject(body, &r)
+	err := w.get(ctx, "user/get", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	return &r, nil
+	return &r.User, nil
 }
 
 // UserListGetByDepartment 根据部门id获取成员列表
@@ -43,36 +52,38 @@ func (w *Wecom) UserGet(userid string) (*User, error) {
 // 如需获取该部门及其子部门的所有成员，需先获取该部门下的子部门，然后再获取子部门下的部门成员，逐层递归获取。
 // 接口返回：userid、name、department、open_userid
 func (w *Wecom) UserListGetByDepartment(departmentId int) ([]User, error) {
+	return w.UserListGetByDepartmentContext(context.Background(), departmentId)
+}
+
+// UserListGetByDepartmentContext 同UserListGetByDepartment，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserListGetByDepartmentContext(ctx context.Context, departmentId int) ([]User, error) {
 	var query = url.Values{}
 	query.Add("department_id", strconv.Itoa(departmentId))
-	body, err := w.get("user/simplelist", query)
-	if err != nil {
-		return nil, err
-	}
-	var r []User
-	err = umarshalObject(body, &r)
+	var r userListResult
+	err := w.get(ctx, "user/simplelist", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	return r, nil
+	return r.UserList, nil
 }
 
 // UserListGetDetailByDepartment 根据部门id获取成员列表的详细信息
 // https://developer.work.weixin.qq.com/document/path/90201
 // 如需获取该部门及其子部门的所有成员，需先获取该部门下的子部门，然后再获取子部门下的部门成员，逐层递归获取。
 func (w *Wecom) UserListGetDetailByDepartment(departmentId int) ([]User, error) {
+	return w.UserListGetDetailByDepartmentContext(context.Background(), departmentId)
+}
+
+// UserListGetDetailByDepartmentContext 同UserListGetDetailByDepartment，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserListGetDetailByDepartmentContext(ctx context.Context, departmentId int) ([]User, error) {
 	var query = url.Values{}
 	query.Add("department_id", strconv.Itoa(departmentId))
-	body, err := w.get("user/list", query)
+	var r userListResult
+	err := w.get(ctx, "user/list", query, &r)
 	if err != nil {
 		return nil, err
 	}
-	var r []User
-	err = umarshalObject(body, &r)
-	if err != nil {
-		return nil, err
-	}
-	return r, nil
+	return r.UserList, nil
 }
 
 // UserUpdate 更新成员
@@ -81,7 +92,12 @@ func (w *Wecom) UserListGetDetailByDepartment(departmentId int) ([]User, error)
 // 如果携带mobile：若成员已激活企业微信，则需成员自行修改（此情况下该参数被忽略，但不会报错）
 // 如果携带email：若是绑定了腾讯企业邮箱的企业微信，则需要在腾讯企业邮箱中修改邮箱（此情况下该参数被忽略，但不会报错）
 func (w *Wecom) UserUpdate(user User) error {
-	_, err := w.post("user/update", user)
+	return w.UserUpdateContext(context.Background(), user)
+}
+
+// UserUpdateContext 同UserUpdate，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserUpdateContext(ctx context.Context, user User) error {
+	err := w.post(ctx, "user/update", user, nil)
 	if err != nil {
 		return err
 	}
@@ -92,9 +108,14 @@ func (w *Wecom) UserUpdate(user User) error {
 // https://developer.work.weixin.qq.com/document/path/90198
 // userid = "zhangsan"
 func (w *Wecom) UserDelete(userid string) error {
+	return w.UserDeleteContext(context.Background(), userid)
+}
+
+// UserDeleteContext 同UserDelete，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserDeleteContext(ctx context.Context, userid string) error {
 	var query = url.Values{}
 	query.Add("userid", userid)
-	_, err := w.get("user/delete", query)
+	err := w.get(ctx, "user/delete", query, nil)
 	if err != nil {
 		return err
 	}
@@ -105,10 +126,15 @@ func (w *Wecom) UserDelete(userid string) error {
 // https://developer.work.weixin.qq.com/document/path/90199
 // useridlist = ["zhangsan", "lisi"]
 func (w *Wecom) UserBatchDelete(useridList []string) error {
+	return w.UserBatchDeleteContext(context.Background(), useridList)
+}
+
+// UserBatchDeleteContext 同UserBatchDelete，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserBatchDeleteContext(ctx context.Context, useridList []string) error {
 	var r = map[string][]string{
 		"useridlist": useridList,
 	}
-	_, err := w.post("user/batchdelete", r)
+	err := w.post(ctx, "user/batchdelete", r, nil)
 	if err != nil {
 		return err
 	}
@@ -119,14 +145,23 @@ func (w *Wecom) UserBatchDelete(useridList []string) error {
 // https://developer.work.weixin.qq.com/document/path/90202
 // 该接口使用场景为企业支付，在使用企业红包和向员工付款时，需要自行将企业微信的userid转成openid
 func (w *Wecom) UserConvertToOpenID(userid string) (string, error) {
+	return w.UserConvertToOpenIDContext(context.Background(), userid)
+}
+
+// UserConvertToOpenIDContext 同UserConvertToOpenID，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserConvertToOpenIDContext(ctx context.Context, userid string) (string, error) {
 	var r = map[string]string{
 		"userid": userid,
 	}
-	body, err := w.post("user/convert_to_openid", r)
+	var resp struct {
+		Error
+		OpenID string `json:"openid"`
+	}
+	err := w.post(ctx, "user/convert_to_openid", r, &resp)
 	if err != nil {
 		return "", err
 	}
-	return string(body["openid"]), nil
+	return resp.OpenID, nil
 }
 
 // UserConvertToUserID openid转userid
@@ -134,14 +169,23 @@ func (w *Wecom) UserConvertToOpenID(userid string) (string, error) {
 // 该接口主要应用于使用企业支付之后的结果查询。
 // 开发者需要知道某个结果事件的openid对应企业微信内成员的信息时，可以通过调用该接口进行转换查询。
 func (w *Wecom) UserConvertToUserID(openid string) (string, error) {
+	return w.UserConvertToUserIDContext(context.Background(), openid)
+}
+
+// UserConvertToUserIDContext 同UserConvertToUserID，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserConvertToUserIDContext(ctx context.Context, openid string) (string, error) {
 	var r = map[string]string{
 		"openid": openid,
 	}
-	body, err := w.post("user/convert_to_userid", r)
+	var resp struct {
+		Error
+		UserID string `json:"userid"`
+	}
+	err := w.post(ctx, "user/convert_to_userid", r, &resp)
 	if err != nil {
 		return "", err
 	}
-	return string(body["userid"]), nil
+	return resp.UserID, nil
 }
 
 // UserAuthsucc 企业二次验证接口
@@ -152,9 +196,14 @@ func (w *Wecom) UserConvertToUserID(openid string) (string, error) {
 // 3- 企业收到code后，使用“通讯录同步助手”调用接口"根据code获取成员信息"获取成员的userid"
 // 4- 如果成员是首次加入企业，企业获取到userid，并验证了成员信息后，调用如下接口即可让成员成功加入企业
 func (w *Wecom) UserAuthsucc(userid string) error {
+	return w.UserAuthsuccContext(context.Background(), userid)
+}
+
+// UserAuthsuccContext 同UserAuthsucc，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserAuthsuccContext(ctx context.Context, userid string) error {
 	var query = url.Values{}
 	query.Add("userid", userid)
-	_, err := w.get("user/authsucc", query)
+	err := w.get(ctx, "user/authsucc", query, nil)
 	if err != nil {
 		return err
 	}
@@ -165,6 +214,11 @@ func (w *Wecom) UserAuthsucc(userid string) error {
 // https://developer.work.weixin.qq.com/document/path/90975
 // 企业可通过接口批量邀请成员使用企业微信，邀请后将通过短信或邮件下发通知
 func (w *Wecom) UserBatchInvite(useridList, partyList, tagList []string) (*UserInvalidList, error) {
+	return w.UserBatchInviteContext(context.Background(), useridList, partyList, tagList)
+}
+
+// UserBatchInviteContext 同UserBatchInvite，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserBatchInviteContext(ctx context.Context, useridList, partyList, tagList []string) (*UserInvalidList, error) {
 	var a = map[string][]string{}
 	if len(useridList) > 0 {
 		a["user"] = useridList
@@ -175,45 +229,62 @@ func (w *Wecom) UserBatchInvite(useridList, partyList, tagList []string) (*UserI
 	if len(tagList) > 0 {
 		a["tag"] = tagList
 	}
-	body, err := w.post("batch/invite", a)
-	if err != nil {
-		return nil, err
+	var r struct {
+		Error
+		UserInvalidList
 	}
-	var r UserInvalidList
-	err = umarshalObject(body, &r)
+	err := w.post(ctx, "batch/invite", a, &r)
 	if err != nil {
 		return nil, err
 	}
-	return &r, nil
+	return &r.UserInvalidList, nil
 }
 
 // UserGetJoinQrcode 获取加入企业二维码, 返回二维码链接
 // https://developer.work.weixin.qq.com/document/path/91714
 // size_type用于控制二维码图片尺寸，1=171*171, 2=399*399, 3=741*741, 4=2052*2052
 func (w *Wecom) UserGetJoinQrcode(sizeType ...int) (string, error) {
+	return w.UserGetJoinQrcodeContext(context.Background(), sizeType...)
+}
+
+// UserGetJoinQrcodeContext 同UserGetJoinQrcode，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserGetJoinQrcodeContext(ctx context.Context, sizeType ...int) (string, error) {
 	var query = url.Values{}
 	if len(sizeType) > 0 {
 		query.Add("size_type", strconv.Itoa(sizeType[0]))
 	}
-	body, err := w.get("corp/get_join_qrcode", query)
+	var resp struct {
+		Error
+		JoinQrcode string `json:"join_qrcode"`
+	}
+	err := w.get(ctx, "corp/get_join_qrcode", query, &resp)
 	if err != nil {
 		return "", err
 	}
-	return string(body["join_qrcode"]), nil
+	return resp.JoinQrcode, nil
 }
 
 // UserGetIDByMobile 通过手机号获取其所对应的userid
 // https://developer.work.weixin.qq.com/document/path/95402
 // mobile - 用户手机号
 func (w *Wecom) UserGetIDByMobile(mobile string) (string, error) {
+	return w.UserGetIDByMobileContext(context.Background(), mobile)
+}
+
+// UserGetIDByMobileContext 同UserGetIDByMobile，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserGetIDByMobileContext(ctx context.Context, mobile string) (string, error) {
 	var a = map[string]string{
 		"mobile": mobile,
 	}
-	body, err := w.post("user/getuserid", a)
+	var resp struct {
+		Error
+		UserID string `json:"userid"`
+	}
+	err := w.post(ctx, "user/getuserid", a, &resp)
 	if err != nil {
 		return "", err
 	}
-	return string(body["userid"]), nil
+	return resp.UserID, nil
 }
 
 // UserGetIDByEmail 通过email获取用户ID
@@ -221,17 +292,26 @@ func (w *Wecom) UserGetIDByMobile(mobile string) (string, error) {
 // email - 用户电子邮箱地址
 // email_type - 1=企业邮箱，2=个人邮箱
 func (w *Wecom) UserGetIDByEmail(email string, emailType ...int) (string, error) {
-	var a = map[string]string{
+	return w.UserGetIDByEmailContext(context.Background(), email, emailType...)
+}
+
+// UserGetIDByEmailContext 同UserGetIDByEmail，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserGetIDByEmailContext(ctx context.Context, email string, emailType ...int) (string, error) {
+	var a = map[string]any{
 		"email": email,
 	}
 	if len(emailType) > 0 {
-		a["email_type"] = strconv.Itoa(emailType[0])
+		a["email_type"] = emailType[0]
 	}
-	body, err := w.post("user/get_userid_by_email", a)
+	var resp struct {
+		Error
+		UserID string `json:"userid"`
+	}
+	err := w.post(ctx, "user/get_userid_by_email", a, &resp)
 	if err != nil {
 		return "", err
 	}
-	return string(body["userid"]), nil
+	return resp.UserID, nil
 }
 
 // UserGetIDList 获取企业成员的userid与对应的部门ID列表
@@ -240,20 +320,37 @@ func (w *Wecom) UserGetIDByEmail(email string, emailType ...int) (string, error)
 // limit - 分页，预期请求的数据量，取值范围 1 ~ 10000
 // 返回值 - 新的游标，用户列表(仅包含userid和department)，错误
 func (w *Wecom) UserGetIDList(cursor string, limit int) (string, []User, error) {
-	var a = map[string]string{
+	return w.UserGetIDListContext(context.Background(), cursor, limit)
+}
+
+// UserGetIDListContext 同UserGetIDList，支持通过ctx取消请求或设置超时
+func (w *Wecom) UserGetIDListContext(ctx context.Context, cursor string, limit int) (string, []User, error) {
+	var a = map[string]any{
 		"cursor": cursor,
-		"limit":  strconv.Itoa(limit),
+		"limit":  limit,
 	}
-	body, err := w.post("user/list_id", a)
-	if err != nil {
-		return "", nil, err
+	var resp struct {
+		Error
+		NextCursor string `json:"next_cursor"`
+		DeptUser   []struct {
+			UserID     string `json:"userid"`
+			Department int    `json:"department"`
+		} `json:"dept_user"`
 	}
-	nextCursor := string(body["next_cursor"])
-	userListBytes := body["dept_user"]
-	var r []User
-	err = json.Unmarshal(userListBytes, &r)
+	err := w.post(ctx, "user/list_id", a, &resp)
 	if err != nil {
 		return "", nil, err
 	}
-	return nextCursor, r, nil
+	// dept_user中每条记录为成员与一个部门的对应关系
+	r := make([]User, 0, len(resp.DeptUser))
+	for _, du := range resp.DeptUser {
+		r = append(r, User{UserID: du.UserID, Department: []int{du.Department}})
+	}
+	return resp.NextCursor, r, nil
+}
+
+// userListResult 部门成员列表
+type userListResult struct {
+	Error
+	UserList []User `json:"userlist"`
 }
@@ -0,0 +1,145 @@
+package wecom
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// APIError 企业微信接口返回的错误
+// 可通过 errors.As 获取错误详情，或通过 errors.Is(err, ErrCodeXXX) 按错误码判断
+type APIError struct {
+	Code int    // 企业微信错误码
+	Msg  string // 企业微信错误信息
+	Path string // 请求的接口路径
+	Hint string // 错误信息中的hint，向企业微信反馈问题时需提供
+}
+
+func (e *APIError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("wecom: errcode=%d errmsg=%s", e.Code, e.Msg)
+	}
+	return fmt.Sprintf("wecom %s: errcode=%d errmsg=%s", e.Path, e.Code, e.Msg)
+}
+
+// Is 支持与ErrCode或其他APIError按错误码匹配
+func (e *APIError) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrCode:
+		return e.Code == int(t)
+	case *APIError:
+		return e.Code == t.Code
+	}
+	return false
+}
+
+// ErrCode 企业微信全局错误码，可直接作为errors.Is的匹配目标
+// 全局错误码说明：https://developer.work.weixin.qq.com/document/path/90313
+type ErrCode int
+
+const (
+	ErrCodeSystemBusy             ErrCode = -1     // 系统繁忙
+	ErrCodeInvalidSecret          ErrCode = 40001  // 不合法的secret参数
+	ErrCodeInvalidUserID          ErrCode = 40003  // 无效的UserID
+	ErrCodeInvalidCorpID          ErrCode = 40013  // 不合法的CorpID
+	ErrCodeInvalidAccessToken     ErrCode = 40014  // 不合法的access_token
+	ErrCodeInvalidOauthCode       ErrCode = 40029  // 不合法的oauth_code
+	ErrCodeInvalidUserIDList      ErrCode = 40031  // 不合法的UserID列表
+	ErrCodeInvalidUserIDListSize  ErrCode = 40032  // 不合法的UserID列表长度
+	ErrCodeInvalidParam           ErrCode = 40035  // 不合法的参数
+	ErrCodeInvalidAgentID         ErrCode = 40056  // 不合法的agentid
+	ErrCodeInvalidPartyList       ErrCode = 40066  // 不合法的部门列表
+	ErrCodeInvalidTagID           ErrCode = 40068  // 不合法的标签ID
+	ErrCodeTagRangeInvalid        ErrCode = 40070  // 指定的标签范围结点全部无效
+	ErrCodeInvalidTagName         ErrCode = 40071  // 不合法的标签名字
+	ErrCodeMissingAccessToken     ErrCode = 41001  // 缺少access_token参数
+	ErrCodeMissingCorpID          ErrCode = 41002  // 缺少corpid参数
+	ErrCodeMissingSecret          ErrCode = 41004  // 缺少secret参数
+	ErrCodeAccessTokenExpired     ErrCode = 42001  // access_token已过期
+	ErrCodeAPIFreqLimit           ErrCode = 45009  // 接口调用超过限制
+	ErrCodeAPIConcurrentLimit     ErrCode = 45033  // 接口并发调用超过限制
+	ErrCodeAPIForbidden           ErrCode = 48002  // API接口无权限调用
+	ErrCodeRedirectURLNotTrusted  ErrCode = 50001  // redirect_url未登记可信域名
+	ErrCodeDepartmentNotFound     ErrCode = 60003  // 部门不存在
+	ErrCodeParentDepartmentAbsent ErrCode = 60004  // 父部门不存在
+	ErrCodeDepartmentExists       ErrCode = 60008  // 部门已存在
+	ErrCodeNoPrivilege            ErrCode = 60011  // 指定的成员/部门/标签参数无权限
+	ErrCodeIPNotAllowed           ErrCode = 60020  // 访问ip不在白名单之中
+	ErrCodeUserIDExists           ErrCode = 60102  // UserID已存在
+	ErrCodeInvalidMobile          ErrCode = 60103  // 手机号码不合法
+	ErrCodeMobileExists           ErrCode = 60104  // 手机号码已存在
+	ErrCodeInvalidEmail           ErrCode = 60105  // 邮箱不合法
+	ErrCodeEmailExists            ErrCode = 60106  // 邮箱已存在
+	ErrCodeUserNotFound           ErrCode = 60111  // UserID不存在
+	ErrCodeInvalidUserName        ErrCode = 60112  // 成员name参数不合法
+	ErrCodeInvalidDepartmentID    ErrCode = 60123  // 无效的部门id
+	ErrCodeCannotDeleteCreator    ErrCode = 301005 // 不允许删除创建者
+)
+
+var errCodeDescriptions = map[ErrCode]string{
+	ErrCodeSystemBusy:             "系统繁忙",
+	ErrCodeInvalidSecret:          "不合法的secret参数",
+	ErrCodeInvalidUserID:          "无效的UserID",
+	ErrCodeInvalidCorpID:          "不合法的CorpID",
+	ErrCodeInvalidAccessToken:     "不合法的access_token",
+	ErrCodeInvalidOauthCode:       "不合法的oauth_code",
+	ErrCodeInvalidUserIDList:      "不合法的UserID列表",
+	ErrCodeInvalidUserIDListSize:  "不合法的UserID列表长度",
+	ErrCodeInvalidParam:           "不合法的参数",
+	ErrCodeInvalidAgentID:         "不合法的agentid",
+	ErrCodeInvalidPartyList:       "不合法的部门列表",
+	ErrCodeInvalidTagID:           "不合法的标签ID",
+	ErrCodeTagRangeInvalid:        "指定的标签范围结点全部无效",
+	ErrCodeInvalidTagName:         "不合法的标签名字",
+	ErrCodeMissingAccessToken:     "缺少access_token参数",
+	ErrCodeMissingCorpID:          "缺少corpid参数",
+	ErrCodeMissingSecret:          "缺少secret参数",
+	ErrCodeAccessTokenExpired:     "access_token已过期",
+	ErrCodeAPIFreqLimit:           "接口调用超过限制",
+	ErrCodeAPIConcurrentLimit:     "接口并发调用超过限制",
+	ErrCodeAPIForbidden:           "API接口无权限调用",
+	ErrCodeRedirectURLNotTrusted:  "redirect_url未登记可信域名",
+	ErrCodeDepartmentNotFound:     "部门不存在",
+	ErrCodeParentDepartmentAbsent: "父部门不存在",
+	ErrCodeDepartmentExists:       "部门已存在",
+	ErrCodeNoPrivilege:            "指定的成员/部门/标签参数无权限",
+	ErrCodeIPNotAllowed:           "访问ip不在白名单之中",
+	ErrCodeUserIDExists:           "UserID已存在",
+	ErrCodeInvalidMobile:          "手机号码不合法",
+	ErrCodeMobileExists:           "手机号码已存在",
+	ErrCodeInvalidEmail:           "邮箱不合法",
+	ErrCodeEmailExists:            "邮箱已存在",
+	ErrCodeUserNotFound:           "UserID不存在",
+	ErrCodeInvalidUserName:        "成员name参数不合法",
+	ErrCodeInvalidDepartmentID:    "无效的部门id",
+	ErrCodeCannotDeleteCreator:    "不允许删除创建者",
+}
+
+func (c ErrCode) Error() string {
+	return fmt.Sprintf("wecom: errcode=%d %s", int(c), c.Description())
+}
+
+// Description 错误码的中文说明，未收录的错误码返回空字符串
+func (c ErrCode) Description() string {
+	return errCodeDescriptions[c]
+}
+
+// hintPattern 匹配errmsg中的 hint: [xxx]
+var hintPattern = regexp.MustCompile(`hint: \[([^\]]+)\]`)
+
+// newAPIError 根据错误码与错误信息构建APIError，并解析其中的hint
+// path - 接口路径，统一为以/开头的形式
+func newAPIError(code int, msg, path string) *APIError {
+	if path != "" {
+		path = "/" + strings.TrimPrefix(path, "/")
+	}
+	e := &APIError{
+		Code: code,
+		Msg:  msg,
+		Path: path,
+	}
+	if m := hintPattern.FindStringSubmatch(msg); m != nil {
+		e.Hint = m[1]
+	}
+	return e
+}
@@ -0,0 +1,379 @@
+package wecom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// goldenServer 返回testdata/golden中与接口路径对应的响应，如user/get对应user_get.json
+type goldenServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	method   string
+	path     string
+	body     []byte
+	override []byte // 不为空时替代fixture作为响应
+}
+
+func newGoldenServer(t *testing.T) *goldenServer {
+	t.Helper()
+	s := &goldenServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *goldenServer) serve(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/gettoken" {
+		fmt.Fprint(rw, `{"errcode":0,"errmsg":"ok","access_token":"golden-token","expires_in":7200}`)
+		return
+	}
+	if r.URL.Query().Get("access_token") != "golden-token" {
+		fmt.Fprintf(rw, `{"errcode":%d,"errmsg":"invalid access_token"}`, ErrCodeInvalidAccessToken)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.method, s.path, s.body = r.Method, p, body
+	override := s.override
+	s.mu.Unlock()
+	if override != nil {
+		_, _ = rw.Write(override)
+		return
+	}
+	b, err := os.ReadFile(filepath.Join("testdata", "golden", strings.ReplaceAll(p, "/", "_")+".json"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	}
+	_, _ = rw.Write(b)
+}
+
+func TestGoldenResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		call   func(w *Wecom) (any, error)
+		want   any
+	}{
+		// 成员管理
+		{"UserCreate", http.MethodPost, "user/create", func(w *Wecom) (any, error) {
+			return nil, w.UserCreate(User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+		}, nil},
+		{"UserGet", http.MethodGet, "user/get", func(w *Wecom) (any, error) {
+			return w.UserGet("zhangsan")
+		}, &User{
+			UserID:           "zhangsan",
+			Name:             "张三",
+			Department:       []int{1, 2},
+			OpenUserid:       "xxxxxx",
+			Order:            []int{1, 2},
+			Position:         "后台工程师",
+			Mobile:           "13800000000",
+			Gender:           "1",
+			Email:            "zhangsan@gzdev.com",
+			BizMail:          "zhangsan@qyycs2.wecom.work",
+			IsLeaderInDept:   []int{1, 0},
+			DirectLeader:     []string{"lisi", "wangwu"},
+			Avatar:           "http://wx.qlogo.cn/mmopen/ajNVdqHZLLA3WJ6DSZUfiakYe37PKnQhBIeOQBO4czqrnZDS79FH5Wm5m4X69TBicnHFlhiafvDwklOpZeXYQQ2icg/0",
+			ThumbAvatar:      "http://wx.qlogo.cn/mmopen/ajNVdqHZLLA3WJ6DSZUfiakYe37PKnQhBIeOQBO4czqrnZDS79FH5Wm5m4X69TBicnHFlhiafvDwklOpZeXYQQ2icg/100",
+			Telephone:        "020-123456",
+			Alias:            "jackzhang",
+			Status:           1,
+			Address:          "广州市海珠区新港中路",
+			MainDepartment:   1,
+			QrCode:           "https://open.work.weixin.qq.com/wwopen/userQRCode?vcode=xxx",
+			ExternalPosition: "产品经理",
+			ExternalProfile: &UserExternalProfile{
+				ExternalCorpName: "企业简称",
+				WechatChannels:   &UserWechatChannel{Nickname: "视频号名称", Status: 1},
+				ExternalAttr:     []UserExternalAttr{newTextAttr("文本名称", "文本")},
+			},
+		}},
+		{"UserListGetByDepartment", http.MethodGet, "user/simplelist", func(w *Wecom) (any, error) {
+			return w.UserListGetByDepartment(1)
+		}, []User{
+			{UserID: "zhangsan", Name: "张三", Department: []int{1, 2}, OpenUserid: "xxxxxx"},
+			{UserID: "lisi", Name: "李四", Department: []int{2}, OpenUserid: "yyyyyy"},
+		}},
+		{"UserListGetDetailByDepartment", http.MethodGet, "user/list", func(w *Wecom) (any, error) {
+			return w.UserListGetDetailByDepartment(1)
+		}, []User{{
+			UserID:         "zhangsan",
+			Name:           "张三",
+			Department:     []int{1, 2},
+			Order:          []int{1, 2},
+			Position:       "后台工程师",
+			Mobile:         "13800000000",
+			Gender:         "1",
+			Email:          "zhangsan@gzdev.com",
+			IsLeaderInDept: []int{1, 0},
+			DirectLeader:   []string{"lisi"},
+			Status:         1,
+			MainDepartment: 1,
+		}}},
+		{"UserUpdate", http.MethodPost, "user/update", func(w *Wecom) (any, error) {
+			return nil, w.UserUpdate(User{UserID: "zhangsan", Name: "张三"})
+		}, nil},
+		{"UserDelete", http.MethodGet, "user/delete", func(w *Wecom) (any, error) {
+			return nil, w.UserDelete("zhangsan")
+		}, nil},
+		{"UserBatchDelete", http.MethodPost, "user/batchdelete", func(w *Wecom) (any, error) {
+			return nil, w.UserBatchDelete([]string{"zhangsan", "lisi"})
+		}, nil},
+		{"UserConvertToOpenID", http.MethodPost, "user/convert_to_openid", func(w *Wecom) (any, error) {
+			return w.UserConvertToOpenID("zhangsan")
+		}, "oDjGHs-1yCnGrRovBj2yHij5JAAA"},
+		{"UserConvertToUserID", http.MethodPost, "user/convert_to_userid", func(w *Wecom) (any, error) {
+			return w.UserConvertToUserID("oDjGHs-1yCnGrRovBj2yHij5JAAA")
+		}, "zhangsan"},
+		{"UserAuthsucc", http.MethodGet, "user/authsucc", func(w *Wecom) (any, error) {
+			return nil, w.UserAuthsucc("zhangsan")
+		}, nil},
+		{"UserBatchInvite", http.MethodPost, "batch/invite", func(w *Wecom) (any, error) {
+			return w.UserBatchInvite([]string{"UserID1", "UserID2"}, nil, nil)
+		}, &UserInvalidList{InvalidUser: []string{"UserID1", "UserID2"}, InvalidParty: []string{}, InvalidTag: []string{}}},
+		{"UserGetJoinQrcode", http.MethodGet, "corp/get_join_qrcode", func(w *Wecom) (any, error) {
+			return w.UserGetJoinQrcode(3)
+		}, "https://work.weixin.qq.com/wework_admin/genqrcode?action=join&vcode=3db1fab03118ae2aa1544cb9abe84&r=hb_share_api_mjoin&qr_size=3"},
+		{"UserGetIDByMobile", http.MethodPost, "user/getuserid", func(w *Wecom) (any, error) {
+			return w.UserGetIDByMobile("13800000000")
+		}, "zhangsan"},
+		{"UserGetIDByEmail", http.MethodPost, "user/get_userid_by_email", func(w *Wecom) (any, error) {
+			return w.UserGetIDByEmail("zhangsan@gzdev.com")
+		}, "zhangsan"},
+		{"UserGetIDList", http.MethodPost, "user/list_id", func(w *Wecom) (any, error) {
+			cursor, users, err := w.UserGetIDList("", 1000)
+			return []any{cursor, users}, err
+		}, []any{"xxxxxx", []User{
+			{UserID: "userid1", Department: []int{1}},
+			{UserID: "userid1", Department: []int{2}},
+			{UserID: "userid2", Department: []int{1}},
+		}}},
+		{"UserIdGetFromCode", http.MethodGet, "auth/getuserinfo", func(w *Wecom) (any, error) {
+			return w.UserIdGetFromCode("CODE")
+		}, "USERID"},
+		{"OauthGetUserinfo", http.MethodGet, "user/getuserinfo", func(w *Wecom) (any, error) {
+			return w.OauthGetUserinfo("CODE")
+		}, "USERID"},
+
+		// 部门管理
+		{"DepartmentCreate", http.MethodPost, "department/create", func(w *Wecom) (any, error) {
+			return w.DepartmentCreate(Department{Name: "广州研发中心", ParentId: 1})
+		}, 1234567},
+		{"DepartmentUpdate", http.MethodPost, "department/update", func(w *Wecom) (any, error) {
+			return nil, w.DepartmentUpdate(Department{Id: 2, Name: "广州研发中心"})
+		}, nil},
+		{"DepartmentDelete", http.MethodGet, "department/delete", func(w *Wecom) (any, error) {
+			return nil, w.DepartmentDelete(2)
+		}, nil},
+		{"DepartmentGet", http.MethodGet, "department/get", func(w *Wecom) (any, error) {
+			return w.DepartmentGet(2)
+		}, &Department{Id: 2, Name: "广州研发中心", NameEn: "RDGZ", Leaders: []string{"zhangsan", "lisi"}, ParentId: 1, Order: 10}},
+		{"DepartmentListGet", http.MethodGet, "department/list", func(w *Wecom) (any, error) {
+			return w.DepartmentListGet()
+		}, []Department{
+			{Id: 2, Name: "广州研发中心", NameEn: "RDGZ", Leaders: []string{"zhangsan", "lisi"}, ParentId: 1, Order: 10},
+			{Id: 3, Name: "邮箱产品部", NameEn: "mail", Leaders: []string{"lisi", "wangwu"}, ParentId: 2, Order: 40},
+		}},
+		{"DepartmentSubIDListGet", http.MethodGet, "department/simplelist", func(w *Wecom) (any, error) {
+			return w.DepartmentSubIDListGet(1)
+		}, []Department{{Id: 2, ParentId: 1, Order: 10}, {Id: 3, ParentId: 2, Order: 40}}},
+
+		// 标签管理
+		{"TagCreate", http.MethodPost, "tag/create", func(w *Wecom) (any, error) {
+			return w.TagCreate("乒乓球协会")
+		}, 1234567},
+		{"TagUpdate", http.MethodPost, "tag/update", func(w *Wecom) (any, error) {
+			return nil, w.TagUpdate("乒乓球协会", 12)
+		}, nil},
+		{"TagDelete", http.MethodGet, "tag/delete", func(w *Wecom) (any, error) {
+			return nil, w.TagDelete(12)
+		}, nil},
+		{"TagGetUser", http.MethodGet, "tag/get", func(w *Wecom) (any, error) {
+			name, parties, users, err := w.TagGetUser(12)
+			return []any{name, parties, users}, err
+		}, []any{"乒乓球协会", []int{2}, []User{{UserID: "zhangsan", Name: "李四"}}}},
+		{"TagAddUsers", http.MethodPost, "tag/addtagusers", func(w *Wecom) (any, error) {
+			invalid, parties, err := w.TagAddUsers(12, []string{"usr1"}, []int{2})
+			return []any{invalid, parties}, err
+		}, []any{"usr1|usr2|usr", []int{2, 4}}},
+		{"TagDelUsers", http.MethodPost, "tag/deltagusers", func(w *Wecom) (any, error) {
+			invalid, parties, err := w.TagDelUsers(12, []string{"usr1"}, []int{2})
+			return []any{invalid, parties}, err
+		}, []any{"usr1|usr2|usr", []int{2, 4}}},
+		{"TagList", http.MethodGet, "tag/list", func(w *Wecom) (any, error) {
+			return w.TagList()
+		}, []Tag{{TagId: 1, Tagname: "a"}, {TagId: 2, Tagname: "b"}}},
+
+		// 异步导入
+		{"SyncImportUpdateUser", http.MethodPost, "batch/syncuser", func(w *Wecom) (any, error) {
+			return w.SyncImportUpdateUser(Import{MediaID: "media"})
+		}, "xxxxx"},
+		{"SyncImportReplaceUser", http.MethodPost, "batch/replaceuser", func(w *Wecom) (any, error) {
+			return w.SyncImportReplaceUser(Import{MediaID: "media"})
+		}, "xxxxx"},
+		{"SyncImportReplaceParty", http.MethodPost, "batch/replaceparty", func(w *Wecom) (any, error) {
+			return w.SyncImportReplaceParty(Import{MediaID: "media"})
+		}, "xxxxx"},
+		{"SyncImportGetResult", http.MethodGet, "batch/getresult", func(w *Wecom) (any, error) {
+			r, err := w.SyncImportGetResult("xxxxx")
+			if err != nil {
+				return nil, err
+			}
+			var users []ImportUserResult
+			err = json.Unmarshal(r.Result, &users)
+			r.Result = nil
+			return []any{r, users}, err
+		}, []any{
+			&ImportResult{Status: 3, Type: JobTypeSyncUser, Total: 2, Percentage: 100},
+			[]ImportUserResult{
+				{UserID: "lisi", Error: Error{Errcode: 0, Errmsg: "ok"}},
+				{UserID: "zhangsan", Error: Error{Errcode: 60104, Errmsg: "mobile existed"}},
+			},
+		}},
+
+		// 异步导出
+		{"AsyncExportUser", http.MethodPost, "export/simple_user", func(w *Wecom) (any, error) {
+			return w.AsyncExportUser("0123456789abcdef0123456789abcdef")
+		}, "jobid_xxxxxxxxxxxxxxx"},
+		{"AsyncExportUserDetail", http.MethodPost, "export/user", func(w *Wecom) (any, error) {
+			return w.AsyncExportUserDetail("0123456789abcdef0123456789abcdef")
+		}, "jobid_xxxxxxxxxxxxxxx"},
+		{"AsyncExportDepartment", http.MethodPost, "export/department", func(w *Wecom) (any, error) {
+			return w.AsyncExportDepartment("0123456789abcdef0123456789abcdef")
+		}, "jobid_xxxxxxxxxxxxxxx"},
+		{"AsyncExportTagMember", http.MethodPost, "export/taguser", func(w *Wecom) (any, error) {
+			return w.AsyncExportTagMember(12, "0123456789abcdef0123456789abcdef")
+		}, "jobid_xxxxxxxxxxxxxxx"},
+		{"AsyncExportGetResult", http.MethodGet, "export/get_result", func(w *Wecom) (any, error) {
+			return w.AsyncExportGetResult("jobid_xxxxxxxxxxxxxxx")
+		}, &ExportResult{Status: 2, DataList: []ExportUrl{
+			{Url: "https://xxxxx", Size: 100, Md5: "xxxxxxxxx"},
+			{Url: "https://xxxxx", Size: 100, Md5: "xxxxxxxxx"},
+		}}},
+
+		// 未封装的接口
+		{"Get", http.MethodGet, "agent/get", func(w *Wecom) (any, error) {
+			type agent struct {
+				Error
+				AgentID int    `json:"agentid"`
+				Name    string `json:"name"`
+			}
+			r, err := Get[agent](context.Background(), w, "/cgi-bin/agent/get", nil)
+			if err != nil {
+				return nil, err
+			}
+			return []any{r.AgentID, r.Name}, nil
+		}, []any{1000005, "HR助手"}},
+	}
+
+	srv := newGoldenServer(t)
+	w := New("corp", "secret", WithBaseURL(srv.URL), WithRateLimiter(nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call(w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if srv.method != tt.method || srv.path != tt.path {
+				t.Errorf("request = %s %s, want %s %s", srv.method, srv.path, tt.method, tt.path)
+			}
+			if tt.want == nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				gb, _ := json.Marshal(got)
+				wb, _ := json.Marshal(tt.want)
+				t.Errorf("got  %s\nwant %s", gb, wb)
+			}
+		})
+	}
+}
+
+// TestGoldenRequestBodies 校验请求body中数值类型的字段不会被编码为字符串
+func TestGoldenRequestBodies(t *testing.T) {
+	const aeskey = "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name string
+		call func(w *Wecom) error
+		want string
+	}{
+		{"TagCreate", func(w *Wecom) error {
+			_, err := w.TagCreate("UI", 12)
+			return err
+		}, `{"tagname":"UI","tagid":12}`},
+		{"TagUpdate", func(w *Wecom) error {
+			return w.TagUpdate("UI design", 12)
+		}, `{"tagname":"UI design","tagid":12}`},
+		{"UserGetIDByEmail", func(w *Wecom) error {
+			_, err := w.UserGetIDByEmail("zhangsan@gzdev.com", 1)
+			return err
+		}, `{"email":"zhangsan@gzdev.com","email_type":1}`},
+		{"UserGetIDList", func(w *Wecom) error {
+			_, _, err := w.UserGetIDList("", 10000)
+			return err
+		}, `{"cursor":"","limit":10000}`},
+		{"AsyncExportTagMember", func(w *Wecom) error {
+			_, err := w.AsyncExportTagMember(12, aeskey, 100000)
+			return err
+		}, `{"encoding_aeskey":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY","tagid":12,"block_size":100000}`},
+	}
+
+	srv := newGoldenServer(t)
+	w := New("corp", "secret", WithBaseURL(srv.URL), WithRateLimiter(nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(w); err != nil {
+				t.Fatal(err)
+			}
+			var got, want any
+			if err := json.Unmarshal(srv.body, &got); err != nil {
+				t.Fatalf("body %q: %v", srv.body, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %s, want %s", srv.body, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoldenErrorResponse(t *testing.T) {
+	srv := newGoldenServer(t)
+	srv.override = []byte(`{"errcode":60111,"errmsg":"userid not found"}`)
+	w := New("corp", "secret", WithBaseURL(srv.URL), WithRateLimiter(nil))
+
+	_, err := w.UserGet("nobody")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Code != int(ErrCodeUserNotFound) || apiErr.Msg != "userid not found" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if !errors.Is(err, ErrCodeUserNotFound) {
+		t.Error("errors.Is(err, ErrCodeUserNotFound) = false")
+	}
+}
+
+func newTextAttr(name, value string) UserExternalAttr {
+	a := UserExternalAttr{Type: 0, Name: name}
+	a.Text.Value = value
+	return a
+}
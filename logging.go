@@ -0,0 +1,214 @@
+package wecom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// redacted 脱敏后的占位值
+const redacted = "***"
+
+// defaultRedactQuery url中需要脱敏的参数
+var defaultRedactQuery = []string{"access_token", "corpsecret", "code"}
+
+// defaultRedactFields json中需要脱敏的字段，匹配时不区分大小写
+var defaultRedactFields = []string{
+	"access_token", "corpsecret", "encoding_aeskey", "encodingaeskey", "token",
+	"mobile", "email", "biz_mail", "telephone", "address",
+}
+
+// LogOption 日志中间件配置项
+type LogOption func(*logConfig)
+
+type logConfig struct {
+	requestLevel  slog.Level
+	responseLevel slog.Level
+	errorLevel    slog.Level
+	logBody       bool
+	redactFields  map[string]bool
+}
+
+// LogRequestLevel 设置请求日志的级别，默认Debug
+func LogRequestLevel(l slog.Level) LogOption {
+	return func(c *logConfig) {
+		c.requestLevel = l
+	}
+}
+
+// LogResponseLevel 设置成功响应日志的级别，默认Info
+func LogResponseLevel(l slog.Level) LogOption {
+	return func(c *logConfig) {
+		c.responseLevel = l
+	}
+}
+
+// LogErrorLevel 设置失败响应日志的级别，默认Warn
+func LogErrorLevel(l slog.Level) LogOption {
+	return func(c *logConfig) {
+		c.errorLevel = l
+	}
+}
+
+// LogBody 记录脱敏后的请求与响应body
+func LogBody() LogOption {
+	return func(c *logConfig) {
+		c.logBody = true
+	}
+}
+
+// LogRedactFields 额外需要脱敏的json字段
+func LogRedactFields(fields ...string) LogOption {
+	return func(c *logConfig) {
+		for _, f := range fields {
+			c.redactFields[strings.ToLower(f)] = true
+		}
+	}
+}
+
+// NewLogMiddleware 基于slog的日志中间件
+// url中的access_token、corpsecret，body中的手机号、邮箱、座机等字段均会脱敏
+func NewLogMiddleware(logger *slog.Logger, opts ...LogOption) Middleware {
+	c := &logConfig{
+		requestLevel:  slog.LevelDebug,
+		responseLevel: slog.LevelInfo,
+		errorLevel:    slog.LevelWarn,
+		redactFields:  make(map[string]bool),
+	}
+	for _, f := range defaultRedactFields {
+		c.redactFields[f] = true
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return func(next Invoker) Invoker {
+		return func(ctx context.Context, call *CallInfo) error {
+			attrs := []slog.Attr{
+				slog.String("method", call.Method),
+				slog.String("path", call.Path),
+				slog.Int("attempt", call.Attempt),
+			}
+			if logger.Enabled(ctx, c.requestLevel) {
+				reqAttrs := append(attrs[:len(attrs):len(attrs)], slog.String("url", RedactURL(call.Request.URL)))
+				if c.logBody && len(call.RequestBody) > 0 {
+					reqAttrs = append(reqAttrs, slog.String("body", c.redactBody(call.RequestBody)))
+				}
+				logger.LogAttrs(ctx, c.requestLevel, "wecom request", reqAttrs...)
+			}
+
+			err := next(ctx, call)
+
+			level := c.responseLevel
+			if err != nil {
+				level = c.errorLevel
+			}
+			if !logger.Enabled(ctx, level) {
+				return err
+			}
+			attrs = append(attrs,
+				slog.Int("status", call.StatusCode),
+				slog.Int("errcode", call.Errcode),
+				slog.Duration("latency", call.Latency),
+			)
+			if err != nil {
+				attrs = append(attrs, slog.String("error", redactError(err).Error()))
+			}
+			if c.logBody && len(call.ResponseBody) > 0 {
+				attrs = append(attrs, slog.String("body", c.redactBody(call.ResponseBody)))
+			}
+			logger.LogAttrs(ctx, level, "wecom response", attrs...)
+			return err
+		}
+	}
+}
+
+// RedactURL 返回脱敏后的url，access_token、corpsecret与code参数替换为***
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	r := *u
+	q := r.Query()
+	for _, k := range defaultRedactQuery {
+		if q.Has(k) {
+			q.Set(k, redacted)
+		}
+	}
+	r.RawQuery = q.Encode()
+	return r.String()
+}
+
+// redactError 脱敏http.Client返回的*url.Error中的url，其中包含access_token或corpsecret
+// 错误被包装时原地修改其中的*url.Error
+func redactError(err error) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	u, perr := url.Parse(ue.URL)
+	if perr != nil {
+		ue.URL = redacted
+		return err
+	}
+	ue.URL = RedactURL(u)
+	return err
+}
+
+// redactBody 返回脱敏后的json body，非json内容只保留长度信息
+func (c *logConfig) redactBody(b []byte) string {
+	rb, err := redactJSON(b, c.redactFields)
+	if err != nil {
+		return fmt.Sprintf("<non-json body, %d bytes>", len(b))
+	}
+	return string(rb)
+}
+
+// RedactJSON 返回脱敏后的json，默认脱敏字段与日志中间件一致
+// fields - 额外需要脱敏的字段，匹配时不区分大小写
+func RedactJSON(b []byte, fields ...string) ([]byte, error) {
+	m := make(map[string]bool, len(defaultRedactFields)+len(fields))
+	for _, f := range defaultRedactFields {
+		m[f] = true
+	}
+	for _, f := range fields {
+		m[strings.ToLower(f)] = true
+	}
+	return redactJSON(b, m)
+}
+
+func redactJSON(b []byte, fields map[string]bool) ([]byte, error) {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("invalid json: trailing data")
+	}
+	return json.Marshal(redactValue(v, fields))
+}
+
+// redactValue 递归替换敏感字段的值
+func redactValue(v any, fields map[string]bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if fields[strings.ToLower(k)] {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redactValue(val, fields)
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = redactValue(val, fields)
+		}
+	}
+	return v
+}
@@ -0,0 +1,45 @@
+package wecom
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogMiddlewareRedactsTransportError(t *testing.T) {
+	// 关闭服务端，使请求返回包含完整url的*url.Error
+	srv := httptest.NewServer(nil)
+	baseURL := srv.URL
+	srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	w := New("corp", "supersecret", WithBaseURL(baseURL), WithLogger(logger))
+
+	_, err := w.AccessToken()
+	if err == nil {
+		t.Fatal("expected transport error")
+	}
+	if strings.Contains(err.Error(), "supersecret") {
+		t.Errorf("error leaks corpsecret: %v", err)
+	}
+	if strings.Contains(buf.String(), "supersecret") {
+		t.Errorf("log leaks corpsecret:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "corpsecret=") {
+		t.Errorf("log is missing the redacted url:\n%s", buf.String())
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	b, err := RedactJSON([]byte(`{"userid":"zhangsan","mobile":"13800000000","extattr":{"Email":"a@b.c"},"id":12345678901234567}`), "userid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"extattr":{"Email":"***"},"id":12345678901234567,"mobile":"***","userid":"***"}`
+	if string(b) != want {
+		t.Errorf("RedactJSON = %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,105 @@
+package wecom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CallInfo 一次接口调用的信息
+// 中间件在调用next之前可读取/修改请求，在next返回后可读取响应、错误码与耗时
+type CallInfo struct {
+	Method       string        // http方法
+	Path         string        // 接口路径，不含/cgi-bin前缀与开头的"/"，如"user/get"、"gettoken"
+	Attempt      int           // 第几次尝试，从1开始，token失效或频率限制重试时递增
+	Request      *http.Request // 即将发送的请求，可用于添加自定义header
+	RequestBody  []byte        // 请求body，get请求为空
+	StatusCode   int           // http状态码
+	ResponseBody []byte        // 响应body
+	Errcode      int           // 企业微信错误码
+	Errmsg       string        // 企业微信错误信息
+	Latency      time.Duration // 请求耗时
+
+	result any  // 响应的解析目标
+	raw    bool // 响应不是企业微信的json，如导出文件，只校验http状态码
+}
+
+// Invoker 执行一次接口调用
+// 企业微信返回非0错误码时，返回*APIError
+type Invoker func(ctx context.Context, call *CallInfo) error
+
+// Middleware 包装Invoker，用于日志、监控、链路追踪、自定义header等
+type Middleware func(next Invoker) Invoker
+
+// chainMiddlewares 组装中间件，先注册的中间件位于外层
+func chainMiddlewares(mws []Middleware, core Invoker) Invoker {
+	h := core
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// roundTrip 最内层的Invoker，发送请求并解析错误码
+func (w *Wecom) roundTrip(_ context.Context, call *CallInfo) error {
+	start := time.Now()
+	resp, err := w.httpClient.Do(call.Request)
+	if err != nil {
+		call.Latency = time.Since(start)
+		return redactError(err)
+	}
+	defer resp.Body.Close()
+	call.StatusCode = resp.StatusCode
+	call.ResponseBody, err = io.ReadAll(resp.Body)
+	call.Latency = time.Since(start)
+	if err != nil {
+		return err
+	}
+	if call.raw {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("wecom: %s: unexpected http status %s", call.Path, resp.Status)
+		}
+		return nil
+	}
+	ecode, err := decodeResponse(call.ResponseBody, call.result)
+	if err != nil {
+		return err
+	}
+	call.Errcode, call.Errmsg = ecode.Errcode, ecode.Errmsg
+	if ecode.Errcode != 0 {
+		return newAPIError(ecode.Errcode, ecode.Errmsg, call.Path)
+	}
+	return nil
+}
+
+// responder 内嵌了Error的响应结构
+type responder interface {
+	apiError() *Error
+}
+
+// decodeResponse 将响应解析到out中并返回其中的错误码
+// out内嵌Error时只需一次解析；否则先解析错误码，成功后再解析到out
+func decodeResponse(body []byte, out any) (*Error, error) {
+	if r, ok := out.(responder); ok {
+		err := json.Unmarshal(body, r)
+		if err != nil {
+			return nil, err
+		}
+		return r.apiError(), nil
+	}
+	ecode := &Error{}
+	err := json.Unmarshal(body, ecode)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil && ecode.Errcode == 0 {
+		err = json.Unmarshal(body, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ecode, nil
+}
@@ -0,0 +1,115 @@
+package wecom
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// callRecorder 记录经过中间件的调用路径
+type callRecorder struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (rec *callRecorder) middleware(next Invoker) Invoker {
+	return func(ctx context.Context, call *CallInfo) error {
+		rec.mu.Lock()
+		rec.paths = append(rec.paths, call.Path)
+		rec.mu.Unlock()
+		return next(ctx, call)
+	}
+}
+
+func TestMiddlewareSeesOauthAndDownload(t *testing.T) {
+	const aeskey = "0123456789abcdef0123456789abcdef"
+	plain := []byte(`{"userlist":[]}`)
+	// 与企业微信一致，PKCS#7填充至32字节的倍数
+	block, err := aes.NewCipher([]byte(aeskey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := 32 - len(plain)%32
+	file := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, []byte(aeskey[:16])).CryptBlocks(file, file)
+	tokens := 0
+	oauthCalls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gettoken":
+			tokens++
+			fmt.Fprintf(rw, `{"errcode":0,"errmsg":"ok","access_token":"t%d","expires_in":7200}`, tokens)
+		case "/user/getuserinfo":
+			oauthCalls++
+			if r.URL.Query().Get("access_token") == "t1" {
+				fmt.Fprintf(rw, `{"errcode":%d,"errmsg":"access_token expired"}`, ErrCodeAccessTokenExpired)
+				return
+			}
+			fmt.Fprint(rw, `{"errcode":0,"errmsg":"ok","UserId":"zhangsan","DeviceId":""}`)
+		case "/download":
+			_, _ = rw.Write(file)
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	defer srv.Close()
+
+	rec := &callRecorder{}
+	w := New("corp", "secret", WithBaseURL(srv.URL), WithRateLimiter(nil), WithMiddleware(rec.middleware))
+
+	userID, err := w.OauthGetUserinfo("code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != "zhangsan" || oauthCalls != 2 {
+		t.Fatalf("userID = %q, oauth calls = %d", userID, oauthCalls)
+	}
+
+	b, err := w.AsyncExportDownloadResult(aeskey, ExportUrl{
+		Url:  srv.URL + "/download",
+		Size: len(file),
+		Md5:  fmt.Sprintf("%x", md5.Sum(file)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(plain) {
+		t.Fatalf("downloaded = %q", b)
+	}
+
+	_, err = w.AsyncExportDownloadResult(aeskey, ExportUrl{Url: srv.URL + "/missing"})
+	if err == nil {
+		t.Fatal("expected error for 404 download")
+	}
+
+	want := []string{"gettoken", "user/getuserinfo", "gettoken", "user/getuserinfo", exportDownloadPath, exportDownloadPath}
+	if fmt.Sprint(rec.paths) != fmt.Sprint(want) {
+		t.Fatalf("middleware saw %v, want %v", rec.paths, want)
+	}
+}
+
+func TestCallInfoPathFormat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"errcode":0,"errmsg":"ok","access_token":"t","expires_in":7200}`)
+	}))
+	defer srv.Close()
+
+	rec := &callRecorder{}
+	w := New("corp", "secret", WithBaseURL(srv.URL), WithRateLimiter(nil), WithMiddleware(rec.middleware))
+	for _, p := range []string{"agent/get", "/agent/get", "/cgi-bin/agent/get"} {
+		if _, err := Get[Error](context.Background(), w, p, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"gettoken", "agent/get", "agent/get", "agent/get"}
+	if fmt.Sprint(rec.paths) != fmt.Sprint(want) {
+		t.Fatalf("middleware saw %v, want %v", rec.paths, want)
+	}
+}
@@ -2,8 +2,8 @@ package wecom
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
+	"strconv"
+	"strings"
 )
 
 // User 用户信息
@@ -39,8 +39,8 @@ type User struct {
 type UserExternalProfile struct {
 	ExternalCorpName string `json:"external_corp_name,omitempty"`
 
-	WechatChannels []UserWechatChannel `json:"wechat_channels,omitempty"`
-	ExternalAttr   []UserExternalAttr  `json:"external_attr,omitempty"`
+	WechatChannels *UserWechatChannel `json:"wechat_channels,omitempty"` // 视频号，接口中为单个对象
+	ExternalAttr   []UserExternalAttr `json:"external_attr,omitempty"`
 }
 
 // UserWechatChannel 视频号属性
@@ -126,6 +126,12 @@ type ImportPartyResult struct {
 	Error
 }
 
+// jobResult 异步导入、导出接口返回的任务ID
+type jobResult struct {
+	Error
+	JobID string `json:"jobid"`
+}
+
 // ExportResult 通过任务ID查询的导出结果
 type ExportResult struct {
 	Status   int         `json:"status"`    // 任务状态:0-未处理，1-处理中，2-完成，3-异常失败
@@ -142,11 +148,11 @@ type ExportUrl struct {
 // - MsgType = event
 //   - Event = batch_job_result
 //     - JobType = export_user(导出成员详情)
-//	   - JobType = export_simple_user(导出成员)
-//	   - JobType = export_department(导出部门)
-//	   - JobType = export_tag(导出标签成员)
-//	   - JobType = sync_user(增量更新成员完成通知)
-// 	   - JobType = replace_user(全量覆盖成员完成通知)
+//     - JobType = export_simple_user(导出成员)
+//     - JobType = export_department(导出部门)
+//     - JobType = export_taguser(导出标签成员)
+//     - JobType = sync_user(增量更新成员完成通知)
+//     - JobType = replace_user(全量覆盖成员完成通知)
 //     - JobType = invite_user(邀请成员关注完成通知)
 //     - JobType = replace_party(全量覆盖部门完成通知)
 //   - Event = change_contact
@@ -165,30 +171,227 @@ type CallbackEvent struct {
 	CreateTime   int    `xml:"CreateTime"`   // 消息创建时间 （整型）
 	MsgType      string `xml:"MsgType"`      // 消息的类型
 	Event        string `xml:"Event"`        // 事件的类型
+	ChangeType   string `xml:"ChangeType"`   // 通讯录变更的类型，仅change_contact事件有值
+	MsgId        string `xml:"MsgId"`        // 消息id，仅用户消息有值，可用于排重
+}
+
+// ContactUserEvent 成员变更事件
+// 对应 ChangeType = create_user、update_user、delete_user
+// update_user只推送发生变更的字段，未变更的字段为零值；delete_user只有UserID
+type ContactUserEvent struct {
+	CallbackEvent
+	UserID         string               `xml:"UserID"`         // 成员UserID
+	NewUserID      string               `xml:"NewUserID"`      // 变更后的UserID，仅update_user且UserID发生变更时有值
+	Name           string               `xml:"Name"`           // 成员名称
+	Department     CommaInts            `xml:"Department"`     // 成员部门列表
+	MainDepartment int                  `xml:"MainDepartment"` // 主部门
+	IsLeaderInDept CommaInts            `xml:"IsLeaderInDept"` // 是否为部门负责人，与Department一一对应，1表示为负责人
+	DirectLeader   CommaStrings         `xml:"DirectLeader"`   // 直属上级UserID
+	Position       string               `xml:"Position"`       // 职位信息
+	Mobile         string               `xml:"Mobile"`         // 手机号码
+	Gender         string               `xml:"Gender"`         // 性别，1表示男性，2表示女性
+	Email          string               `xml:"Email"`          // 邮箱
+	BizMail        string               `xml:"BizMail"`        // 企业邮箱
+	Status         int                  `xml:"Status"`         // 激活状态：1表示已激活，2表示已禁用，4表示未激活
+	Avatar         string               `xml:"Avatar"`         // 头像url
+	Alias          string               `xml:"Alias"`          // 成员别名
+	Telephone      string               `xml:"Telephone"`      // 座机
+	Address        string               `xml:"Address"`        // 地址
+	ExtAttr        []ContactExtAttrItem `xml:"ExtAttr>Item"`   // 扩展属性
+}
+
+// ContactExtAttrItem 成员变更事件中的扩展属性
+type ContactExtAttrItem struct {
+	Name string `xml:"Name"`
+	Type int    `xml:"Type"` // 属性类型: 0-文本 1-网页
+	Text struct {
+		Value string `xml:"Value"`
+	} `xml:"Text"`
+	Web struct {
+		Title string `xml:"Title"`
+		Url   string `xml:"Url"`
+	} `xml:"Web"`
+}
+
+// ContactPartyEvent 部门变更事件
+// 对应 ChangeType = create_party、update_party、delete_party
+// update_party只推送发生变更的字段；delete_party只有Id
+type ContactPartyEvent struct {
+	CallbackEvent
+	Id       int    `xml:"Id"`       // 部门Id
+	Name     string `xml:"Name"`     // 部门名称
+	ParentId int    `xml:"ParentId"` // 父部门id
+	Order    int    `xml:"Order"`    // 部门排序，仅create_party有值
+}
+
+// ContactTagEvent 标签成员变更事件
+// 对应 ChangeType = update_tag
+type ContactTagEvent struct {
+	CallbackEvent
+	TagId         int          `xml:"TagId"`         // 标签Id
+	AddUserItems  CommaStrings `xml:"AddUserItems"`  // 标签中新增的成员userid列表
+	DelUserItems  CommaStrings `xml:"DelUserItems"`  // 标签中删除的成员userid列表
+	AddPartyItems CommaInts    `xml:"AddPartyItems"` // 标签中新增的部门id列表
+	DelPartyItems CommaInts    `xml:"DelPartyItems"` // 标签中删除的部门id列表
+}
+
+// CommaInts 回调中以逗号分隔的整数列表，如"1,2,3"
+type CommaInts []int
+
+func (c *CommaInts) UnmarshalText(b []byte) error {
+	*c = nil
+	for _, v := range strings.Split(string(b), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*c = append(*c, i)
+	}
+	return nil
 }
 
-// BatchJobResult 导出任务完成通知
-// 对应 Callback.Event = "batch_job_result"
-// -> BatchJob []BatchJob
+func (c CommaInts) MarshalText() ([]byte, error) {
+	s := make([]string, len(c))
+	for i, v := range c {
+		s[i] = strconv.Itoa(v)
+	}
+	return []byte(strings.Join(s, ",")), nil
+}
+
+// CommaStrings 回调中以逗号分隔的字符串列表，如"zhangsan,lisi"
+type CommaStrings []string
+
+func (c *CommaStrings) UnmarshalText(b []byte) error {
+	*c = nil
+	for _, v := range strings.Split(string(b), ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*c = append(*c, v)
+		}
+	}
+	return nil
+}
+
+func (c CommaStrings) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(c, ",")), nil
+}
+
+// 异步任务的类型，对应batch_job_result事件中的JobType
+const (
+	JobTypeSyncUser         = "sync_user"          // 增量更新成员
+	JobTypeReplaceUser      = "replace_user"       // 全量覆盖成员
+	JobTypeInviteUser       = "invite_user"        // 邀请成员关注
+	JobTypeReplaceParty     = "replace_party"      // 全量覆盖部门
+	JobTypeExportUser       = "export_user"        // 导出成员详情
+	JobTypeExportSimpleUser = "export_simple_user" // 导出成员
+	JobTypeExportDepartment = "export_department"  // 导出部门
+	JobTypeExportTagUser    = "export_taguser"     // 导出标签成员
+)
+
+// BatchJobEvent 异步任务完成事件
+// 对应 Event = batch_job_result
+type BatchJobEvent struct {
+	CallbackEvent
+	BatchJob BatchJob `xml:"BatchJob"`
+}
+
+// BatchJob 异步任务完成通知中的任务信息
+// 导入任务可通过SyncImportGetResult获取结果，导出任务可通过AsyncExportGetResult获取结果
 type BatchJob struct {
-	JobId   string `xml:"JobId"`
-	JobType string `xml:"JobType"`
+	JobId   string `xml:"JobId"`   // 异步任务id
+	JobType string `xml:"JobType"` // 任务类型，见JobTypeXXX
 	Error
 }
 
+// IsExport 是否为导出任务
+func (j *BatchJob) IsExport() bool {
+	return strings.HasPrefix(j.JobType, "export_")
+}
+
+// 接收消息：https://developer.work.weixin.qq.com/document/path/90239
+// - MsgType = text(文本消息)、image(图片消息)、voice(语音消息)、video(视频消息)、location(位置消息)、link(链接消息)
+
+// 用户消息的类型，对应回调中的MsgType
+const (
+	MsgTypeText     = "text"
+	MsgTypeImage    = "image"
+	MsgTypeVoice    = "voice"
+	MsgTypeVideo    = "video"
+	MsgTypeLocation = "location"
+	MsgTypeLink     = "link"
+)
+
+// UserMsg 用户消息的公共字段
+type UserMsg struct {
+	CallbackEvent
+	AgentID int `xml:"AgentID"` // 企业应用的id
+}
+
+// TextMsg 文本消息
+type TextMsg struct {
+	UserMsg
+	Content string `xml:"Content"` // 文本消息内容
+}
+
+// ImageMsg 图片消息
+type ImageMsg struct {
+	UserMsg
+	PicUrl  string `xml:"PicUrl"`  // 图片链接
+	MediaId string `xml:"MediaId"` // 图片媒体文件id，可以调用获取媒体文件接口拉取，仅三天内有效
+}
+
+// VoiceMsg 语音消息
+type VoiceMsg struct {
+	UserMsg
+	MediaId string `xml:"MediaId"` // 语音媒体文件id，可以调用获取媒体文件接口拉取数据，仅三天内有效
+	Format  string `xml:"Format"`  // 语音格式，如amr，speex等
+}
+
+// VideoMsg 视频消息
+type VideoMsg struct {
+	UserMsg
+	MediaId      string `xml:"MediaId"`      // 视频媒体文件id，可以调用获取媒体文件接口拉取数据，仅三天内有效
+	ThumbMediaId string `xml:"ThumbMediaId"` // 视频消息缩略图的媒体id，可以调用获取媒体文件接口拉取数据，仅三天内有效
+}
+
+// LocationMsg 位置消息
+type LocationMsg struct {
+	UserMsg
+	LocationX float64 `xml:"Location_X"` // 地理位置纬度
+	LocationY float64 `xml:"Location_Y"` // 地理位置经度
+	Scale     int     `xml:"Scale"`      // 地图缩放大小
+	Label     string  `xml:"Label"`      // 地理位置信息
+	AppType   string  `xml:"AppType"`    // app类型，在企业微信固定返回wxwork，在微信不返回该字段
+}
+
+// LinkMsg 链接消息
+type LinkMsg struct {
+	UserMsg
+	Title       string `xml:"Title"`       // 标题
+	Description string `xml:"Description"` // 描述
+	Url         string `xml:"Url"`         // 链接跳转的url
+	PicUrl      string `xml:"PicUrl"`      // 封面缩略图的url
+}
+
 type Error struct {
 	Errcode int    `json:"errcode" xml:"ErrCode"`
 	Errmsg  string `json:"errmsg" xml:"ErrMsg"`
 }
 
+func (e *Error) apiError() *Error {
+	return e
+}
+
+// Check 错误码非0时返回*APIError
 func (e Error) Check() error {
 	if e.Errcode == 0 {
 		return nil
 	}
-	if e.Errmsg != "" {
-		return errors.New(e.Errmsg)
-	}
-	return errors.New(fmt.Sprintf("request error with code %d", e.Errcode))
+	return newAPIError(e.Errcode, e.Errmsg, "")
 }
 
 // CodeAuthRequest 用户发起授权码验证的请求信息
@@ -0,0 +1,233 @@
+package wecom
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 回调消息加解密：https://developer.work.weixin.qq.com/document/path/90968
+// 与官方WXBizMsgCrypt示例的算法一致：
+// - msg_signature = sha1(sort(token, timestamp, nonce, msg_encrypt))
+// - AESKey = Base64_Decode(EncodingAESKey + "=")，IV取AESKey前16字节
+// - 明文 = random(16B) + msg_len(4B，网络字节序) + msg + receiveid，PKCS#7填充至32字节的倍数
+
+var (
+	ErrInvalidAESKey     = errors.New("wecom: invalid EncodingAESKey")
+	ErrSignatureMismatch = errors.New("wecom: msg_signature mismatch")
+	ErrReceiveIDMismatch = errors.New("wecom: receiveid mismatch")
+	ErrInvalidCiphertext = errors.New("wecom: invalid ciphertext")
+)
+
+// msgCryptBlockSize 回调协议的PKCS#7填充块大小
+const msgCryptBlockSize = 32
+
+// MsgCrypt 企业微信回调消息的加解密与签名校验
+type MsgCrypt struct {
+	token     string
+	aesKey    []byte
+	receiveID string
+}
+
+// NewMsgCrypt 创建回调消息加解密工具
+// token、encodingAESKey - 管理后台回调配置中的Token与EncodingAESKey
+// receiveID - 企业应用为corpid，第三方应用为suiteid，为空时不校验消息中的receiveid
+func NewMsgCrypt(token, encodingAESKey, receiveID string) (*MsgCrypt, error) {
+	if len(encodingAESKey) != 43 {
+		return nil, ErrInvalidAESKey
+	}
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidAESKey
+	}
+	return &MsgCrypt{
+		token:     token,
+		aesKey:    key,
+		receiveID: receiveID,
+	}, nil
+}
+
+// VerifyURL 验证回调URL，校验签名后返回解密的echostr，需原样写回响应
+func (c *MsgCrypt) VerifyURL(msgSignature, timestamp, nonce, echostr string) ([]byte, error) {
+	err := c.verify(msgSignature, timestamp, nonce, echostr)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decrypt(echostr)
+}
+
+// DecryptMsg 校验签名并解密回调的消息体
+// body - POST请求的body，支持xml与json两种格式
+func (c *MsgCrypt) DecryptMsg(msgSignature, timestamp, nonce string, body []byte) ([]byte, error) {
+	encrypted, err := parseEncryptedBody(body)
+	if err != nil {
+		return nil, err
+	}
+	err = c.verify(msgSignature, timestamp, nonce, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decrypt(encrypted)
+}
+
+// EncryptMsg 加密被动回复的消息，返回xml格式的响应包
+func (c *MsgCrypt) EncryptMsg(msg []byte, timestamp, nonce string) ([]byte, error) {
+	encrypted, err := c.Encrypt(msg)
+	if err != nil {
+		return nil, err
+	}
+	return xml.Marshal(encryptedReply{
+		Encrypt:      cdata{encrypted},
+		MsgSignature: cdata{c.Signature(timestamp, nonce, encrypted)},
+		TimeStamp:    timestamp,
+		Nonce:        cdata{nonce},
+	})
+}
+
+// EncryptMsgJSON 同EncryptMsg，返回json格式的响应包，其中timestamp为数字
+func (c *MsgCrypt) EncryptMsgJSON(msg []byte, timestamp, nonce string) ([]byte, error) {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("wecom: invalid timestamp %q", timestamp)
+	}
+	encrypted, err := c.Encrypt(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encryptedReplyJSON{
+		Encrypt:      encrypted,
+		MsgSignature: c.Signature(timestamp, nonce, encrypted),
+		TimeStamp:    ts,
+		Nonce:        nonce,
+	})
+}
+
+// Signature 计算消息签名
+func (c *MsgCrypt) Signature(timestamp, nonce, encrypted string) string {
+	list := []string{c.token, timestamp, nonce, encrypted}
+	sort.Strings(list)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(list, ""))))
+}
+
+// Encrypt 加密消息，返回Base64编码的密文
+func (c *MsgCrypt) Encrypt(msg []byte) (string, error) {
+	plain := make([]byte, 20, 20+len(msg)+len(c.receiveID)+msgCryptBlockSize)
+	_, err := rand.Read(plain[:16])
+	if err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint32(plain[16:20], uint32(len(msg)))
+	plain = append(plain, msg...)
+	plain = append(plain, c.receiveID...)
+	pad := msgCryptBlockSize - len(plain)%msgCryptBlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCEncrypter(block, c.aesKey[:16]).CryptBlocks(plain, plain)
+	return base64.StdEncoding.EncodeToString(plain), nil
+}
+
+// Decrypt 解密Base64编码的密文并校验receiveid，返回消息明文
+func (c *MsgCrypt) Decrypt(encrypted string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(block, c.aesKey[:16]).CryptBlocks(data, data)
+
+	pad := int(data[len(data)-1])
+	if pad < 1 || pad > msgCryptBlockSize || pad > len(data) {
+		return nil, ErrInvalidCiphertext
+	}
+	data = data[:len(data)-pad]
+	if len(data) < 20 {
+		return nil, ErrInvalidCiphertext
+	}
+	msgLen := int(binary.BigEndian.Uint32(data[16:20]))
+	if msgLen > len(data)-20 {
+		return nil, ErrInvalidCiphertext
+	}
+	msg := data[20 : 20+msgLen]
+	receiveID := string(data[20+msgLen:])
+	if c.receiveID != "" && receiveID != c.receiveID {
+		return nil, ErrReceiveIDMismatch
+	}
+	return msg, nil
+}
+
+func (c *MsgCrypt) verify(msgSignature, timestamp, nonce, encrypted string) error {
+	expected := c.Signature(timestamp, nonce, encrypted)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(msgSignature)) != 1 {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// encryptedEnvelope 回调请求中的加密消息包
+type encryptedEnvelope struct {
+	ToUserName string `xml:"ToUserName" json:"tousername"`
+	Encrypt    string `xml:"Encrypt" json:"encrypt"`
+	AgentID    string `xml:"AgentID" json:"agentid"`
+}
+
+// parseEncryptedBody 从xml或json格式的消息包中取出密文
+func parseEncryptedBody(body []byte) (string, error) {
+	var env encryptedEnvelope
+	var err error
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '{' {
+		err = json.Unmarshal(b, &env)
+	} else {
+		err = xml.Unmarshal(body, &env)
+	}
+	if err != nil {
+		return "", err
+	}
+	if env.Encrypt == "" {
+		return "", errors.New("wecom: missing Encrypt in callback body")
+	}
+	return env.Encrypt, nil
+}
+
+// cdata 以CDATA形式输出的xml文本
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+// encryptedReply 被动回复的加密响应包
+type encryptedReply struct {
+	XMLName      xml.Name `xml:"xml"`
+	Encrypt      cdata    `xml:"Encrypt"`
+	MsgSignature cdata    `xml:"MsgSignature"`
+	TimeStamp    string   `xml:"TimeStamp"`
+	Nonce        cdata    `xml:"Nonce"`
+}
+
+// encryptedReplyJSON json格式的加密响应包
+type encryptedReplyJSON struct {
+	Encrypt      string `json:"encrypt"`
+	MsgSignature string `json:"msgsignature"`
+	TimeStamp    int64  `json:"timestamp"`
+	Nonce        string `json:"nonce"`
+}
@@ -0,0 +1,92 @@
+package wecom
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 官方WXBizMsgCrypt示例中的数据
+const (
+	sampleMsgSignature = "477715d11cdb4164915debcba66cb864d751f3e6"
+	sampleTimestamp    = "1409659813"
+	sampleNonce        = "1372623149"
+	sampleBody         = "<xml><ToUserName><![CDATA[wx5823bf96d3bd56c7]]></ToUserName><Encrypt><![CDATA[RypEvHKD8QQKFhvQ6QleEB4J58tiPdvo+rtK1I9qca6aM/wvqnLSV5zEPeusUiX5L5X/0lWfrf0QADHHhGd3QczcdCUpj911L3vg3W/sYYvuJTs3TUUkSUXxaccAS0qhxchrRYt66wiSpGLYL42aM6A8dTT+6k4aSknmPj48kzJs8qLjvd4Xgpue06DOdnLxAUHzM6+kDZ+HMZfJYuR+LtwGc2hgf5gsijff0ekUNXZiqATP7PF5mZxZ3Izoun1s4zG4LUMnvw2r+KqCKIw+3IQH03v+BCA9nMELNqbSf6tiWSrXJB3LAVGUcallcrw8V2t9EL4EhzJWrQUax5wLVMNS0+rUPA3k22Ncx4XXZS9o0MBH27Bo6BpNelZpS+/uh9KsNlY6bHCmJU9p8g7m3fVKn28H3KDYA5Pl/T8Z1ptDAVe0lXdQ2YoyyH2uyPIGHBZZIs2pDBS8R07+qN+E7Q==]]></Encrypt><AgentID><![CDATA[218]]></AgentID></xml>"
+)
+
+func newSampleMsgCrypt(t *testing.T) *MsgCrypt {
+	t.Helper()
+	c, err := NewMsgCrypt(testCallbackToken, testCallbackKey, testCallbackCorp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMsgCryptVerifyURL(t *testing.T) {
+	c := newSampleMsgCrypt(t)
+	echo, err := c.VerifyURL("5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3", "1409659589", "263014780",
+		"P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(echo) != "1616140317555161061" {
+		t.Fatalf("echo = %q", echo)
+	}
+}
+
+func TestMsgCryptDecryptMsg(t *testing.T) {
+	c := newSampleMsgCrypt(t)
+	msg, err := c.DecryptMsg(sampleMsgSignature, sampleTimestamp, sampleNonce, []byte(sampleBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	evt, err := ParseCallback(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evt.Key != (EventKey{MsgType: MsgTypeText}) || evt.ToUserName != testCallbackCorp {
+		t.Fatalf("event = %+v", evt)
+	}
+
+	_, err = c.DecryptMsg(strings.Repeat("0", 40), sampleTimestamp, sampleNonce, []byte(sampleBody))
+	if !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("tampered signature: err = %v", err)
+	}
+	other, err := NewMsgCrypt(testCallbackToken, testCallbackKey, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.DecryptMsg(sampleMsgSignature, sampleTimestamp, sampleNonce, []byte(sampleBody))
+	if !errors.Is(err, ErrReceiveIDMismatch) {
+		t.Errorf("receiveid mismatch: err = %v", err)
+	}
+}
+
+func TestMsgCryptEncryptMsgJSON(t *testing.T) {
+	c := newSampleMsgCrypt(t)
+	b, err := c.EncryptMsgJSON([]byte("<xml>hi</xml>"), sampleTimestamp, sampleNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply map[string]any
+	if err = json.Unmarshal(b, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if ts, ok := reply["timestamp"].(float64); !ok || ts != 1409659813 {
+		t.Fatalf("timestamp = %#v, want number", reply["timestamp"])
+	}
+	// json响应包可由DecryptMsg解密
+	msg, err := c.DecryptMsg(reply["msgsignature"].(string), sampleTimestamp, sampleNonce, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "<xml>hi</xml>" {
+		t.Fatalf("msg = %q", msg)
+	}
+
+	if _, err = c.EncryptMsgJSON([]byte("x"), "not-a-number", sampleNonce); err == nil {
+		t.Error("expected error for non-numeric timestamp")
+	}
+}
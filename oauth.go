@@ -9,11 +9,10 @@
 package wecom
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-querystring/query"
-	"io"
 	"net/http"
 	"net/url"
 	"path"
@@ -22,7 +21,7 @@ import (
 const (
 	OauthHost    = `open.work.weixin.qq.com`
 	qrPath       = "/wwopen/sso/qrConnect"
-	userInfoPath = "/user/getuserinfo"
+	userInfoPath = "user/getuserinfo"
 )
 
 type AuthRequest struct {
@@ -35,53 +34,101 @@ type AuthRequest struct {
 
 // OauthGinLogin 执行重定向到企业微信
 func OauthGinLogin(req AuthRequest, c *gin.Context) error {
-	u, err := oauthRequestForm(req)
+	return New("", "").OauthGinLogin(req, c)
+}
+
+// OauthGinLogin 执行重定向到客户端配置的授权登录地址
+func (w *Wecom) OauthGinLogin(req AuthRequest, c *gin.Context) error {
+	u, err := w.OauthURL(req)
 	if err != nil {
 		return err
 	}
-	c.Redirect(http.StatusFound, u.String())
+	c.Redirect(http.StatusFound, u)
 	return nil
 }
 
+// OauthURL 构建扫码授权登录的地址
+func (w *Wecom) OauthURL(req AuthRequest) (string, error) {
+	if w.optErr != nil {
+		return "", w.optErr
+	}
+	u, err := oauthRequestForm(w.oauthBaseURL, req)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
 // OauthGetUserinfo 企业微信认证成功后的回调
 // 返回用户ID,错误
 func OauthGetUserinfo(token, code string) (string, error) {
-	req := http.Request{
-		Method: http.MethodGet,
-		URL: &url.URL{
-			Scheme:   https,
-			Host:     apiHost,
-			Path:     path.Join(basePath, userInfoPath),
-			RawQuery: url.Values{"access_token": []string{token}, "code": []string{code}}.Encode(),
-		},
+	return OauthGetUserinfoContext(context.Background(), token, code)
+}
+
+// OauthGetUserinfoContext 同OauthGetUserinfo，支持通过ctx取消请求或设置超时
+func OauthGetUserinfoContext(ctx context.Context, token, code string) (string, error) {
+	return New("", "").oauthGetUserinfo(ctx, token, code)
+}
+
+// OauthGetUserinfo 企业微信认证成功后的回调，使用客户端的http配置与token
+// 返回用户ID,错误
+func (w *Wecom) OauthGetUserinfo(code string) (string, error) {
+	return w.OauthGetUserinfoContext(context.Background(), code)
+}
+
+// OauthGetUserinfoContext 同OauthGetUserinfo，支持通过ctx取消请求或设置超时
+func (w *Wecom) OauthGetUserinfoContext(ctx context.Context, code string) (string, error) {
+	var r oauthUserinfo
+	err := w.get(ctx, userInfoPath, url.Values{"code": []string{code}}, &r)
+	if err != nil {
+		return "", err
+	}
+	return r.userID()
+}
+
+// oauthUserinfo 网页授权登录获取的用户信息
+type oauthUserinfo struct {
+	Error
+	UserId string `json:"UserId"`
+}
+
+func (r *oauthUserinfo) userID() (string, error) {
+	if r.Errmsg != "ok" || r.UserId == "" {
+		if r.Errmsg == "" {
+			return "", errors.New("获取用户信息失败")
+		}
+		return "", errors.New(r.Errmsg)
 	}
-	resp, err := http.DefaultClient.Do(&req)
+	return r.UserId, nil
+}
+
+// oauthGetUserinfo 使用调用方传入的token获取用户信息，经过限流器与中间件，token失效时不重试
+func (w *Wecom) oauthGetUserinfo(ctx context.Context, token, code string) (string, error) {
+	values := url.Values{"access_token": []string{token}, "code": []string{code}}
+	req, err := w.newRequest(ctx, http.MethodGet, userInfoPath, values, nil)
 	if err != nil {
 		return "", err
 	}
-	bodyBytes, err := io.ReadAll(resp.Body)
+	err = w.wait(ctx, userInfoPath, "")
 	if err != nil {
 		return "", err
 	}
-	var r struct {
-		Errcode int    `json:"errcode"` // 企业微信错误码，正常时为0
-		Errmsg  string `json:"errmsg"`  // 企业微信错误信息，正常时为"ok"
-		UserId  string `json:"UserId"`
+	var r oauthUserinfo
+	call := &CallInfo{
+		Method:  http.MethodGet,
+		Path:    userInfoPath,
+		Attempt: 1,
+		Request: req,
+		result:  &r,
 	}
-	err = json.Unmarshal(bodyBytes, &r)
+	err = w.invoker(ctx, call)
 	if err != nil {
 		return "", err
 	}
-	if r.Errcode != 0 || r.Errmsg != "ok" || r.UserId == "" {
-		if r.Errmsg == "" {
-			return "", errors.New("获取用户信息失败")
-		}
-		return "", errors.New(r.Errmsg)
-	}
-	return r.UserId, nil
+	return r.userID()
 }
 
-func oauthRequestForm(req AuthRequest) (*url.URL, error) {
+func oauthRequestForm(base *url.URL, req AuthRequest) (*url.URL, error) {
 	if req.Appid == "" {
 		return nil, errors.New("appid为空")
 	}
@@ -95,11 +142,8 @@ func oauthRequestForm(req AuthRequest) (*url.URL, error) {
 	if err != nil {
 		return nil, err
 	}
-	r := url.URL{
-		Scheme:   "https",
-		Host:     OauthHost,
-		Path:     qrPath,
-		RawQuery: v.Encode(),
-	}
+	r := *base
+	r.Path = path.Join(r.Path, qrPath)
+	r.RawQuery = v.Encode()
 	return &r, nil
 }
@@ -0,0 +1,155 @@
+package wecom
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Option 客户端配置项，在New时传入
+type Option func(*Wecom)
+
+// WithHTTPClient 使用自定义的http客户端发起所有请求
+// 包括token获取、通用接口、oauth以及导出文件下载
+func WithHTTPClient(c *http.Client) Option {
+	return func(w *Wecom) {
+		if c != nil {
+			w.httpClient = c
+		}
+	}
+}
+
+// WithTransport 使用自定义的RoundTripper，可用于代理、自定义TLS根证书或测试桩
+func WithTransport(rt http.RoundTripper) Option {
+	return func(w *Wecom) {
+		w.transport = rt
+	}
+}
+
+// WithTimeout 设置单次http请求的超时时间
+func WithTimeout(d time.Duration) Option {
+	return func(w *Wecom) {
+		w.timeout = d
+	}
+}
+
+// WithBaseURL 设置接口的基础地址，默认为 https://qyapi.weixin.qq.com/cgi-bin
+// 适用于私有化部署、出口代理或本地测试服务，token获取与所有接口均使用该地址
+// 如：https://wecom.example.com/cgi-bin、http://127.0.0.1:8080/cgi-bin
+func WithBaseURL(rawURL string) Option {
+	return func(w *Wecom) {
+		u, err := parseBaseURL(rawURL)
+		if err != nil {
+			w.optErr = err
+			return
+		}
+		w.baseURL = u
+	}
+}
+
+// WithOauthBaseURL 设置网页授权登录的地址，默认为 https://open.work.weixin.qq.com
+func WithOauthBaseURL(rawURL string) Option {
+	return func(w *Wecom) {
+		u, err := parseBaseURL(rawURL)
+		if err != nil {
+			w.optErr = err
+			return
+		}
+		w.oauthBaseURL = u
+	}
+}
+
+// parseBaseURL 解析基础地址，必须包含scheme与host
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(rawURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q", rawURL)
+	}
+	return u, nil
+}
+
+// WithUserAgent 设置请求头中的User-Agent
+func WithUserAgent(ua string) Option {
+	return func(w *Wecom) {
+		w.userAgent = ua
+	}
+}
+
+// WithTokenRefreshMargin 设置token到期前主动刷新的提前量，默认5分钟
+func WithTokenRefreshMargin(d time.Duration) Option {
+	return func(w *Wecom) {
+		w.tokenMargin = d
+	}
+}
+
+// WithTokenStore 使用共享的token存储，多个进程可共用同一corpid+secret的token
+// 默认使用进程内存储
+func WithTokenStore(store TokenStore) Option {
+	return func(w *Wecom) {
+		w.tokenStore = store
+	}
+}
+
+// WithTokenRetry 设置token失效(40001/40014/42001)时是否自动刷新token并重放请求，默认开启
+func WithTokenRetry(enabled bool) Option {
+	return func(w *Wecom) {
+		w.tokenRetry = enabled
+	}
+}
+
+// WithRateLimiter 设置客户端限流器，传入nil则关闭限流
+// 默认使用进程内共享的限流器，规则为DefaultRateRules
+func WithRateLimiter(l RateLimiter) Option {
+	return func(w *Wecom) {
+		w.limiter = l
+	}
+}
+
+// WithFrequencyBackoff 设置触发频率限制(45009/45033)后的重试策略
+// retries - 最大重试次数，0表示不重试，默认2次
+// base - 首次重试的等待时间，之后每次翻倍，默认1秒，小于等于0时立即重试
+func WithFrequencyBackoff(retries int, base time.Duration) Option {
+	return func(w *Wecom) {
+		w.freqRetries = retries
+		w.freqBackoff = base
+	}
+}
+
+// WithMiddleware 添加请求中间件，作用于token获取与所有接口调用
+// 先添加的中间件位于外层
+func WithMiddleware(mws ...Middleware) Option {
+	return func(w *Wecom) {
+		w.middlewares = append(w.middlewares, mws...)
+	}
+}
+
+// WithLogger 使用slog记录所有请求与响应，敏感信息会被脱敏
+func WithLogger(logger *slog.Logger, opts ...LogOption) Option {
+	return WithMiddleware(NewLogMiddleware(logger, opts...))
+}
+
+// WithSecret 配置某项能力的secret，对应接口族的请求会自动使用该secret的token
+// 如通讯录接口(user/department/tag/batch/export)使用SecretContact
+func WithSecret(name SecretName, secret string) Option {
+	return func(w *Wecom) {
+		if w.secrets == nil {
+			w.secrets = make(map[SecretName]string)
+		}
+		w.secrets[name] = secret
+	}
+}
+
+// WithSecretRoute 指定接口路径前缀使用的secret，优先于默认的路由规则
+// 如 WithSecretRoute("tag/", SecretApp) 使应用自行创建的标签使用应用secret操作
+func WithSecretRoute(prefix string, name SecretName) Option {
+	return func(w *Wecom) {
+		route := secretRoute{prefix: strings.TrimPrefix(prefix, "/"), name: name}
+		w.secretRoutes = append([]secretRoute{route}, w.secretRoutes...)
+	}
+}
@@ -0,0 +1,193 @@
+package wecom
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 接口调用频率限制：https://developer.work.weixin.qq.com/document/path/90312
+
+const (
+	defaultFreqRetries = 2
+	defaultFreqBackoff = time.Second
+	maxFreqBackoff     = 30 * time.Second
+)
+
+// RateScope 限流的统计维度
+type RateScope int
+
+const (
+	RateScopeIP   RateScope = iota // 按出口ip统计，同一进程内的所有客户端共享
+	RateScopeCorp                  // 按企业统计
+	RateScopeApp                   // 按应用(corpid+secret)统计
+)
+
+// RateRule 限流规则，在Window时间内最多允许Limit次调用
+type RateRule struct {
+	Scope   RateScope
+	Path    string // 接口路径前缀，如"user/"，为空则匹配所有接口
+	PerPath bool   // 是否对每个接口分别计数，企业微信的基础频率限制均按单个接口统计
+	Limit   int
+	Window  time.Duration
+}
+
+// DefaultRateRules 企业微信文档中的基础频率限制
+// - 每企业调用单个cgi/api不可超过1万次/分，15万次/小时
+// - 每ip调用单个cgi/api不可超过2万次/分，60万次/小时
+//
+// 文档中没有按应用统计的通用调用次数限制，应用维度的限制(如发送消息)按接收成员与人次计算，
+// 无法按调用次数限流，因此默认规则中没有RateScopeApp；需要时可自定义规则，如
+//
+//	wecom.NewLimiter(append(wecom.DefaultRateRules, wecom.RateRule{Scope: wecom.RateScopeApp, Path: "message/send", Limit: 600, Window: time.Minute})...)
+var DefaultRateRules = []RateRule{
+	{Scope: RateScopeCorp, PerPath: true, Limit: 10000, Window: time.Minute},
+	{Scope: RateScopeCorp, PerPath: true, Limit: 150000, Window: time.Hour},
+	{Scope: RateScopeIP, PerPath: true, Limit: 20000, Window: time.Minute},
+	{Scope: RateScopeIP, PerPath: true, Limit: 600000, Window: time.Hour},
+}
+
+// RateTarget 一次调用的限流标识
+type RateTarget struct {
+	CorpID string
+	App    string // 应用标识，默认为TokenKey(corpid, secret)
+	Path   string // 接口路径，如"user/get"
+}
+
+// RateLimiter 客户端限流器，每次请求前调用Wait，超出频率时阻塞至可用或ctx结束
+type RateLimiter interface {
+	Wait(ctx context.Context, target RateTarget) error
+}
+
+// Limiter 基于令牌桶的RateLimiter实现
+type Limiter struct {
+	mu      sync.Mutex
+	rules   []RateRule
+	buckets map[string]*rateBucket
+}
+
+// defaultLimiter 未配置限流器的客户端共享该实例，保证同一进程的ip维度计数一致
+var defaultLimiter = NewLimiter()
+
+// NewLimiter 创建限流器，未传入规则时使用DefaultRateRules
+func NewLimiter(rules ...RateRule) *Limiter {
+	if len(rules) == 0 {
+		rules = DefaultRateRules
+	}
+	return &Limiter{
+		rules:   rules,
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+func (l *Limiter) Wait(ctx context.Context, target RateTarget) error {
+	p := strings.TrimPrefix(target.Path, "/")
+	var delay time.Duration
+	now := time.Now()
+	for i, rule := range l.rules {
+		if !strings.HasPrefix(p, strings.TrimPrefix(rule.Path, "/")) {
+			continue
+		}
+		if d := l.bucket(i, rule, target, p).reserve(now); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, delay)
+}
+
+func (l *Limiter) bucket(i int, rule RateRule, target RateTarget, p string) *rateBucket {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(i))
+	sb.WriteByte('|')
+	switch rule.Scope {
+	case RateScopeCorp:
+		sb.WriteString(target.CorpID)
+	case RateScopeApp:
+		sb.WriteString(target.App)
+	}
+	if rule.PerPath {
+		sb.WriteByte('|')
+		sb.WriteString(p)
+	}
+	key := sb.String()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newRateBucket(rule.Limit, rule.Window)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// rateBucket 令牌桶，容量为Limit，每Window时间补满
+type rateBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	burst  float64
+	rate   float64 // 每纳秒补充的令牌数
+	last   time.Time
+}
+
+func newRateBucket(limit int, window time.Duration) *rateBucket {
+	return &rateBucket{
+		tokens: float64(limit),
+		burst:  float64(limit),
+		rate:   float64(limit) / float64(window),
+		last:   time.Now(),
+	}
+}
+
+// reserve 预占一个令牌，返回需要等待的时间
+func (b *rateBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+float64(now.Sub(b.last))*b.rate)
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate)
+}
+
+// isFrequencyLimited 判断错误码是否表示触发了频率限制
+func isFrequencyLimited(errcode int) bool {
+	switch ErrCode(errcode) {
+	case ErrCodeAPIFreqLimit, ErrCodeAPIConcurrentLimit:
+		return true
+	}
+	return false
+}
+
+// backoffDelay 第n次(从1开始)重试前的等待时间，指数增长且不超过maxDelay，base小于等于0时不等待
+func backoffDelay(base, maxDelay time.Duration, n int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base << (n - 1)
+	if d <= 0 || d > maxDelay {
+		return maxDelay
+	}
+	return d
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
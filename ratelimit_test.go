@@ -0,0 +1,88 @@
+package wecom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		base time.Duration
+		n    int
+		want time.Duration
+	}{
+		{time.Second, 1, time.Second},
+		{time.Second, 2, 2 * time.Second},
+		{time.Second, 3, 4 * time.Second},
+		{time.Second, 10, maxFreqBackoff},
+		{time.Second, 100, maxFreqBackoff},
+		{0, 1, 0},
+		{0, 5, 0},
+		{-time.Second, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := backoffDelay(tt.base, maxFreqBackoff, tt.n); got != tt.want {
+			t.Errorf("backoffDelay(%v, %d) = %v, want %v", tt.base, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterScopes(t *testing.T) {
+	l := NewLimiter(
+		RateRule{Scope: RateScopeApp, PerPath: true, Limit: 1, Window: time.Hour},
+		RateRule{Scope: RateScopeCorp, Path: "tag/", Limit: 2, Window: time.Hour},
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// 不同应用、不同接口分别计数
+	for _, target := range []RateTarget{
+		{CorpID: "c", App: "a1", Path: "user/get"},
+		{CorpID: "c", App: "a2", Path: "user/get"},
+		{CorpID: "c", App: "a1", Path: "user/list"},
+		{CorpID: "c", App: "a1", Path: "tag/get"},
+		{CorpID: "c", App: "a2", Path: "tag/get"},
+	} {
+		if err := l.Wait(ctx, target); err != nil {
+			t.Fatalf("Wait(%+v) = %v", target, err)
+		}
+	}
+	// 同一应用同一接口超出限制
+	if err := l.Wait(ctx, RateTarget{CorpID: "c", App: "a1", Path: "user/get"}); err == nil {
+		t.Fatal("expected app bucket to be exhausted")
+	}
+}
+
+func TestFrequencyBackoffZeroBase(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gettoken":
+			fmt.Fprint(rw, `{"errcode":0,"errmsg":"ok","access_token":"t","expires_in":7200}`)
+		default:
+			if atomic.AddInt32(&calls, 1) <= 2 {
+				fmt.Fprintf(rw, `{"errcode":%d,"errmsg":"api freq out of limit"}`, ErrCodeAPIFreqLimit)
+				return
+			}
+			fmt.Fprint(rw, `{"errcode":0,"errmsg":"ok","userid":"zhangsan","name":"张三"}`)
+		}
+	}))
+	defer srv.Close()
+
+	w := New("corp", "secret", WithBaseURL(srv.URL), WithRateLimiter(nil), WithFrequencyBackoff(2, 0))
+	start := time.Now()
+	u, err := w.UserGet("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "张三" || calls != 3 {
+		t.Fatalf("user = %+v, calls = %d", u, calls)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("retries with zero backoff took %v", d)
+	}
+}
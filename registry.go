@@ -0,0 +1,160 @@
+package wecom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// AppConfig 单个应用的配置
+// 应用通过AgentID或Name标识：自建应用使用AgentID，通讯录同步、客户联系等系统应用使用Name
+// 同时设置时两者均可用于获取客户端，且获取到的是同一个客户端
+type AppConfig struct {
+	CorpID  string `json:"corpid"`
+	AgentID string `json:"agentid,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Secret  string `json:"secret"`
+
+	Secrets map[SecretName]string `json:"secrets,omitempty"` // 通讯录、客户联系等能力的secret，见WithSecret
+}
+
+// RegistryConfig 客户端注册表的配置文件格式
+//
+//	{"apps": [{"corpid": "ww1", "agentid": "1000002", "secret": "xxx"},
+//	          {"corpid": "ww1", "name": "contact", "secret": "yyy"}]}
+type RegistryConfig struct {
+	Apps []AppConfig `json:"apps"`
+}
+
+// Registry 多企业、多应用的客户端注册表
+// 客户端按corpid+应用标识在首次使用时创建并缓存，所有客户端共享token存储与http配置
+type Registry struct {
+	mu   sync.Mutex
+	apps map[string]*registryEntry // 以corpid+AgentID、corpid+Name为key，同一应用的两个key指向同一项
+	opts []Option
+}
+
+type registryEntry struct {
+	app    AppConfig
+	client *Wecom // 首次获取时创建
+}
+
+// NewRegistry 创建注册表
+// opts - 所有客户端共用的配置，未指定token存储时使用注册表内共享的内存存储
+func NewRegistry(opts ...Option) *Registry {
+	shared := append([]Option{WithTokenStore(NewMemoryTokenStore())}, opts...)
+	return &Registry{
+		apps: make(map[string]*registryEntry),
+		opts: shared,
+	}
+}
+
+// LoadRegistry 从json配置中加载注册表
+func LoadRegistry(r io.Reader, opts ...Option) (*Registry, error) {
+	var c RegistryConfig
+	err := json.NewDecoder(r).Decode(&c)
+	if err != nil {
+		return nil, err
+	}
+	reg := NewRegistry(opts...)
+	for _, app := range c.Apps {
+		err = reg.Register(app)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reg, nil
+}
+
+// LoadRegistryFile 从json配置文件中加载注册表
+func LoadRegistryFile(name string, opts ...Option) (*Registry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadRegistry(f, opts...)
+}
+
+// Register 注册应用，AgentID与Name均设置时分别注册
+// 已注册的同名应用会被替换，其客户端被丢弃，下次获取时按新配置创建
+func (r *Registry) Register(app AppConfig) error {
+	if app.CorpID == "" || app.Secret == "" {
+		return errors.New("corpid或secret为空")
+	}
+	keys := appKeys(app)
+	if len(keys) == 0 {
+		return errors.New("agentid与name不能同时为空")
+	}
+	e := &registryEntry{app: app}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		if old, ok := r.apps[key]; ok {
+			// 被替换的应用的另一个标识也一并移除
+			for _, k := range appKeys(old.app) {
+				if r.apps[k] == old {
+					delete(r.apps, k)
+				}
+			}
+		}
+		r.apps[key] = e
+	}
+	return nil
+}
+
+// Client 获取企业下指定应用的客户端
+// app - 应用的AgentID或Name
+func (r *Registry) Client(corpID, app string) (*Wecom, error) {
+	key := registryKey(corpID, app)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.apps[key]
+	if !ok {
+		return nil, fmt.Errorf("app %s not registered", key)
+	}
+	if e.client != nil {
+		return e.client, nil
+	}
+	opts := r.opts
+	for name, secret := range e.app.Secrets {
+		opts = append(opts[:len(opts):len(opts)], WithSecret(name, secret))
+	}
+	e.client = New(e.app.CorpID, e.app.Secret, opts...)
+	return e.client, nil
+}
+
+// Apps 返回已注册的应用配置
+func (r *Registry) Apps() []AppConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	apps := make([]AppConfig, 0, len(r.apps))
+	seen := make(map[*registryEntry]bool, len(r.apps))
+	for _, e := range r.apps {
+		if seen[e] {
+			continue
+		}
+		seen[e] = true
+		apps = append(apps, e.app)
+	}
+	return apps
+}
+
+// appKeys 应用在注册表中的key
+func appKeys(app AppConfig) []string {
+	var keys []string
+	if app.AgentID != "" {
+		keys = append(keys, registryKey(app.CorpID, app.AgentID))
+	}
+	if app.Name != "" && app.Name != app.AgentID {
+		keys = append(keys, registryKey(app.CorpID, app.Name))
+	}
+	return keys
+}
+
+func registryKey(corpID, app string) string {
+	return corpID + "/" + app
+}
@@ -0,0 +1,71 @@
+package wecom
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	reg, err := LoadRegistry(strings.NewReader(`{"apps": [
+		{"corpid": "ww1", "agentid": "1000002", "name": "oa", "secret": "s1"},
+		{"corpid": "ww1", "name": "contact", "secret": "s2"},
+		{"corpid": "ww2", "agentid": "1000002", "secret": "s3"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reg.Apps()); n != 3 {
+		t.Fatalf("len(Apps()) = %d, want 3", n)
+	}
+
+	byAgent, err := reg.Client("ww1", "1000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName, err := reg.Client("ww1", "oa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byAgent != byName {
+		t.Error("AgentID and Name of the same app should return the same client")
+	}
+	other, err := reg.Client("ww2", "1000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == byAgent || other.corpSecret != "s3" {
+		t.Error("apps of different corps should not share a client")
+	}
+	if _, err = reg.Client("ww1", "missing"); err == nil {
+		t.Error("expected error for unregistered app")
+	}
+
+	// 重新注册后丢弃旧客户端，旧的Name不再可用
+	err = reg.Register(AppConfig{CorpID: "ww1", AgentID: "1000002", Secret: "s4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := reg.Client("ww1", "1000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w == byAgent || w.corpSecret != "s4" {
+		t.Error("re-registered app should get a new client")
+	}
+	if _, err = reg.Client("ww1", "oa"); err == nil {
+		t.Error("name of the replaced app should be removed")
+	}
+	if n := len(reg.Apps()); n != 3 {
+		t.Fatalf("len(Apps()) = %d, want 3", n)
+	}
+
+	for _, app := range []AppConfig{
+		{CorpID: "ww1", Secret: "s"},
+		{CorpID: "ww1", AgentID: "1"},
+		{AgentID: "1", Secret: "s"},
+	} {
+		if err = reg.Register(app); err == nil {
+			t.Errorf("Register(%+v) should fail", app)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package wecom
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// 被动回复消息：https://developer.work.weixin.qq.com/document/path/90241
+// 在回调的处理函数中调用evt.Reply(wecom.NewTextReply("..."))，响应时自动加密
+
+// CDATA 以<![CDATA[...]]>形式输出的文本，与文档中被动回复的格式一致
+type CDATA string
+
+func (c CDATA) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Value string `xml:",cdata"`
+	}{string(c)}, start)
+}
+
+// Reply 被动回复的消息
+type Reply interface {
+	header() *replyHeader
+}
+
+// replyHeader 被动回复的公共字段，收发双方与创建时间在回复时根据收到的消息填充
+type replyHeader struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   CDATA    `xml:"ToUserName"`   // 成员UserID
+	FromUserName CDATA    `xml:"FromUserName"` // 企业微信CorpID
+	CreateTime   int64    `xml:"CreateTime"`
+	MsgType      CDATA    `xml:"MsgType"`
+}
+
+func (h *replyHeader) header() *replyHeader {
+	return h
+}
+
+// TextReply 文本消息
+type TextReply struct {
+	replyHeader
+	Content CDATA `xml:"Content"` // 文本消息内容，最长不超过2048个字节
+}
+
+// NewTextReply 创建文本回复
+func NewTextReply(content string) *TextReply {
+	return &TextReply{replyHeader: replyHeader{MsgType: "text"}, Content: CDATA(content)}
+}
+
+// ReplyMedia 图片、语音回复中的媒体文件
+type ReplyMedia struct {
+	MediaId CDATA `xml:"MediaId"` // 通过素材管理接口上传多媒体文件得到的id
+}
+
+// ImageReply 图片消息
+type ImageReply struct {
+	replyHeader
+	Image ReplyMedia `xml:"Image"`
+}
+
+// NewImageReply 创建图片回复
+func NewImageReply(mediaID string) *ImageReply {
+	return &ImageReply{replyHeader: replyHeader{MsgType: "image"}, Image: ReplyMedia{MediaId: CDATA(mediaID)}}
+}
+
+// VoiceReply 语音消息
+type VoiceReply struct {
+	replyHeader
+	Voice ReplyMedia `xml:"Voice"`
+}
+
+// NewVoiceReply 创建语音回复
+func NewVoiceReply(mediaID string) *VoiceReply {
+	return &VoiceReply{replyHeader: replyHeader{MsgType: "voice"}, Voice: ReplyMedia{MediaId: CDATA(mediaID)}}
+}
+
+// ReplyVideo 视频回复中的视频信息
+type ReplyVideo struct {
+	MediaId     CDATA `xml:"MediaId"`               // 通过素材管理接口上传多媒体文件得到的id
+	Title       CDATA `xml:"Title,omitempty"`       // 视频消息的标题，不超过128个字节
+	Description CDATA `xml:"Description,omitempty"` // 视频消息的描述，不超过512个字节
+}
+
+// VideoReply 视频消息
+type VideoReply struct {
+	replyHeader
+	Video ReplyVideo `xml:"Video"`
+}
+
+// NewVideoReply 创建视频回复
+func NewVideoReply(mediaID, title, description string) *VideoReply {
+	return &VideoReply{
+		replyHeader: replyHeader{MsgType: "video"},
+		Video:       ReplyVideo{MediaId: CDATA(mediaID), Title: CDATA(title), Description: CDATA(description)},
+	}
+}
+
+// ReplyArticle 图文回复中的一篇文章
+type ReplyArticle struct {
+	Title       CDATA `xml:"Title"`       // 标题，不超过128个字节
+	Description CDATA `xml:"Description"` // 描述，不超过512个字节
+	PicUrl      CDATA `xml:"PicUrl"`      // 图片链接，较好的效果为大图640x320，小图80x80
+	Url         CDATA `xml:"Url"`         // 点击后跳转的链接
+}
+
+// NewsReply 图文消息
+type NewsReply struct {
+	replyHeader
+	ArticleCount int            `xml:"ArticleCount"`  // 图文消息的数量，不超过8
+	Articles     []ReplyArticle `xml:"Articles>item"` // 图文消息列表
+}
+
+// NewNewsReply 创建图文回复
+func NewNewsReply(articles ...ReplyArticle) *NewsReply {
+	return &NewsReply{
+		replyHeader:  replyHeader{MsgType: "news"},
+		ArticleCount: len(articles),
+		Articles:     articles,
+	}
+}
+
+// UpdateButtonReply 更新点击用户的模板卡片按钮
+// 仅可在模板卡片事件(template_card_event)的回调中回复
+type UpdateButtonReply struct {
+	replyHeader
+	Button struct {
+		ReplaceName CDATA `xml:"ReplaceName"` // 点击卡片按钮后显示的按钮名称
+	} `xml:"Button"`
+}
+
+// NewUpdateButtonReply 创建更新按钮回复
+func NewUpdateButtonReply(replaceName string) *UpdateButtonReply {
+	r := &UpdateButtonReply{replyHeader: replyHeader{MsgType: "update_button"}}
+	r.Button.ReplaceName = CDATA(replaceName)
+	return r
+}
+
+// MarshalReply 生成回复收到消息的明文xml，收发双方与收到的消息相反
+func MarshalReply(evt *CallbackEvent, r Reply) ([]byte, error) {
+	h := r.header()
+	h.ToUserName = CDATA(evt.FromUserName)
+	h.FromUserName = CDATA(evt.ToUserName)
+	h.CreateTime = time.Now().Unix()
+	return xml.Marshal(r)
+}
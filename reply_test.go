@@ -0,0 +1,94 @@
+package wecom
+
+import (
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// 期望的xml与文档中被动回复的示例格式一致：https://developer.work.weixin.qq.com/document/path/90241
+func TestMarshalReply(t *testing.T) {
+	const header = `<ToUserName><![CDATA[toUser]]></ToUserName>` +
+		`<FromUserName><![CDATA[fromUser]]></FromUserName>` +
+		`<CreateTime>1348831860</CreateTime>`
+	tests := []struct {
+		name  string
+		reply Reply
+		want  string
+	}{
+		{"text", NewTextReply("this is a test"), `<xml>` + header +
+			`<MsgType><![CDATA[text]]></MsgType>` +
+			`<Content><![CDATA[this is a test]]></Content>` +
+			`</xml>`},
+		{"image", NewImageReply("media_id"), `<xml>` + header +
+			`<MsgType><![CDATA[image]]></MsgType>` +
+			`<Image><MediaId><![CDATA[media_id]]></MediaId></Image>` +
+			`</xml>`},
+		{"voice", NewVoiceReply("media_id"), `<xml>` + header +
+			`<MsgType><![CDATA[voice]]></MsgType>` +
+			`<Voice><MediaId><![CDATA[media_id]]></MediaId></Voice>` +
+			`</xml>`},
+		{"video", NewVideoReply("media_id", "title", "description"), `<xml>` + header +
+			`<MsgType><![CDATA[video]]></MsgType>` +
+			`<Video><MediaId><![CDATA[media_id]]></MediaId><Title><![CDATA[title]]></Title><Description><![CDATA[description]]></Description></Video>` +
+			`</xml>`},
+		{"video without title", NewVideoReply("media_id", "", ""), `<xml>` + header +
+			`<MsgType><![CDATA[video]]></MsgType>` +
+			`<Video><MediaId><![CDATA[media_id]]></MediaId></Video>` +
+			`</xml>`},
+		{"news", NewNewsReply(
+			ReplyArticle{Title: "title1", Description: "description1", PicUrl: "picurl", Url: "url"},
+			ReplyArticle{Title: "title", Description: "description", PicUrl: "picurl", Url: "url"},
+		), `<xml>` + header +
+			`<MsgType><![CDATA[news]]></MsgType>` +
+			`<ArticleCount>2</ArticleCount>` +
+			`<Articles>` +
+			`<item><Title><![CDATA[title1]]></Title><Description><![CDATA[description1]]></Description><PicUrl><![CDATA[picurl]]></PicUrl><Url><![CDATA[url]]></Url></item>` +
+			`<item><Title><![CDATA[title]]></Title><Description><![CDATA[description]]></Description><PicUrl><![CDATA[picurl]]></PicUrl><Url><![CDATA[url]]></Url></item>` +
+			`</Articles>` +
+			`</xml>`},
+		{"update_button", NewUpdateButtonReply("ReplaceName"), `<xml>` + header +
+			`<MsgType><![CDATA[update_button]]></MsgType>` +
+			`<Button><ReplaceName><![CDATA[ReplaceName]]></ReplaceName></Button>` +
+			`</xml>`},
+		{"escaping", NewTextReply("a]]>b<c>"), `<xml>` + header +
+			`<MsgType><![CDATA[text]]></MsgType>` +
+			`<Content><![CDATA[a]]]]><![CDATA[>b<c>]]></Content>` +
+			`</xml>`},
+	}
+	evt := &CallbackEvent{ToUserName: "fromUser", FromUserName: "toUser"}
+	createTime := regexp.MustCompile(`<CreateTime>\d+</CreateTime>`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := MarshalReply(evt, tt.reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := createTime.ReplaceAllString(string(b), "<CreateTime>1348831860</CreateTime>")
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalReplyRoundTrip(t *testing.T) {
+	b, err := MarshalReply(&CallbackEvent{ToUserName: "corp", FromUserName: "zhangsan"}, NewTextReply("你好 <世界> & ]]>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		ToUserName string `xml:"ToUserName"`
+		Content    string `xml:"Content"`
+	}
+	if err = xml.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ToUserName != "zhangsan" || got.Content != "你好 <世界> & ]]>" {
+		t.Fatalf("decoded = %+v from %s", got, b)
+	}
+	if !strings.HasPrefix(string(b), "<xml>") {
+		t.Fatalf("root element = %s", b)
+	}
+}
@@ -0,0 +1,75 @@
+package wecom
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// SecretName 企业微信中不同能力对应的secret
+// 通讯录、客户联系、审批、打卡等能力需要使用各自的secret获取token，应用相关接口使用应用的secret
+type SecretName string
+
+const (
+	SecretApp             SecretName = "app"             // 应用secret，即New时传入的secret
+	SecretContact         SecretName = "contact"         // 通讯录同步secret
+	SecretExternalContact SecretName = "externalcontact" // 客户联系secret
+	SecretApproval        SecretName = "approval"        // 审批应用secret
+	SecretCheckin         SecretName = "checkin"         // 打卡应用secret
+)
+
+// secretRoute 接口路径前缀与secret的对应关系
+type secretRoute struct {
+	prefix string
+	name   SecretName
+}
+
+// defaultSecretRoutes 各接口族默认使用的secret，按顺序匹配第一个前缀
+var defaultSecretRoutes = []secretRoute{
+	{"user/getuserinfo", SecretApp}, // 网页授权登录使用应用的token
+	{"user/", SecretContact},
+	{"department/", SecretContact},
+	{"tag/", SecretContact},
+	{"batch/", SecretContact},
+	{"export/", SecretContact},
+	{"corp/get_join_qrcode", SecretContact},
+	{"externalcontact/", SecretExternalContact},
+	{"oa/", SecretApproval},
+	{"corp/getapprovaldata", SecretApproval},
+	{"checkin/", SecretCheckin},
+	{"message/", SecretApp},
+}
+
+// tokenFor 根据接口路径选择对应secret的token管理器，p不含开头的"/"
+// 未配置对应secret时使用应用secret
+func (w *Wecom) tokenFor(p string) *tokenManager {
+	for _, r := range w.secretRoutes {
+		if !strings.HasPrefix(p, r.prefix) {
+			continue
+		}
+		if m, ok := w.secretTokens[r.name]; ok {
+			return m
+		}
+		break
+	}
+	return w.tokens
+}
+
+// buildSecretTokens 为每个配置的secret创建token管理器
+// 与应用secret相同的secret共用同一个管理器
+func (w *Wecom) buildSecretTokens() {
+	w.secretTokens = make(map[SecretName]*tokenManager, len(w.secrets))
+	for name, secret := range w.secrets {
+		if secret == w.corpSecret {
+			w.secretTokens[name] = w.tokens
+			continue
+		}
+		w.secretTokens[name] = w.newTokenManager(secret)
+	}
+}
+
+func (w *Wecom) newTokenManager(secret string) *tokenManager {
+	return newTokenManager(func(ctx context.Context) (string, time.Duration, error) {
+		return w.fetchToken(ctx, secret)
+	}, w.tokenMargin, w.tokenStore, TokenKey(w.corpID, secret))
+}
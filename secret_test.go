@@ -0,0 +1,34 @@
+package wecom
+
+import (
+	"testing"
+)
+
+func TestTokenFor(t *testing.T) {
+	w := New("corp", "app",
+		WithSecret(SecretContact, "contact"),
+		WithSecret(SecretExternalContact, "ext"),
+		WithSecret(SecretApproval, "app"),
+		WithSecretRoute("tag/", SecretApp),
+	)
+	tests := []struct {
+		path string
+		want *tokenManager
+	}{
+		{"user/get", w.secretTokens[SecretContact]},
+		{"user/getuserinfo", w.tokens},
+		{"department/list", w.secretTokens[SecretContact]},
+		{"export/simple_user", w.secretTokens[SecretContact]},
+		{"tag/list", w.tokens},
+		{"externalcontact/list", w.secretTokens[SecretExternalContact]},
+		{"oa/getapprovaldetail", w.tokens},   // 与应用secret相同，共用管理器
+		{"checkin/getcheckindata", w.tokens}, // 未配置打卡secret
+		{"message/send", w.tokens},
+		{"agent/get", w.tokens},
+	}
+	for _, tt := range tests {
+		if got := w.tokenFor(tt.path); got != tt.want {
+			t.Errorf("tokenFor(%q) uses %s, want %s", tt.path, got.key, tt.want.key)
+		}
+	}
+}
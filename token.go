@@ -0,0 +1,181 @@
+package wecom
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultTokenMargin token到期前提前刷新的时间，企业微信的token有效期一般为7200秒
+const defaultTokenMargin = 5 * time.Minute
+
+// tokenFetchTimeout 单次刷新token的最长时间，包括等待store的锁
+const tokenFetchTimeout = time.Minute
+
+// tokenFetcher 从企业微信获取新的token，返回token与有效时长
+type tokenFetcher func(ctx context.Context) (string, time.Duration, error)
+
+// tokenManager 并发安全的access_token管理器
+// - 在token到期前margin时间内主动刷新
+// - 多个协程同时刷新时，只会发起一次请求，其余协程等待该请求的结果
+// - 刷新前先查询store，复用其他进程已刷新的token
+type tokenManager struct {
+	mu        sync.Mutex
+	token     string
+	expire    time.Time
+	refreshAt time.Time // 到达该时间后主动刷新
+	margin    time.Duration
+	fetch     tokenFetcher
+	store     TokenStore
+	key       string     // token在store中的键
+	call      *tokenCall // 正在进行中的刷新请求
+}
+
+// tokenCall 一次进行中的刷新请求
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func newTokenManager(fetch tokenFetcher, margin time.Duration, store TokenStore, key string) *tokenManager {
+	return &tokenManager{
+		fetch:  fetch,
+		margin: margin,
+		store:  store,
+		key:    key,
+	}
+}
+
+// Get 获取可用的token，若token不存在或即将过期则刷新
+func (m *tokenManager) Get(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	if m.fresh() {
+		token := m.token
+		m.mu.Unlock()
+		return token, nil
+	}
+	return m.refreshLocked(ctx, "")
+}
+
+// Refresh 强制刷新token，并发的刷新会被合并为一次请求
+// 当前持有的token不会再从store中复用
+func (m *tokenManager) Refresh(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	return m.refreshLocked(ctx, m.token)
+}
+
+// Invalidate 标记token失效并刷新
+// 若当前token已不是stale，说明其他协程已完成刷新，直接返回当前token
+func (m *tokenManager) Invalidate(ctx context.Context, stale string) (string, error) {
+	m.mu.Lock()
+	if m.token != stale && m.fresh() {
+		token := m.token
+		m.mu.Unlock()
+		return token, nil
+	}
+	return m.refreshLocked(ctx, stale)
+}
+
+// Current 返回当前缓存的token及其过期时间，不发起请求
+func (m *tokenManager) Current() (string, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token, m.expire
+}
+
+// fresh 判断token是否在安全有效期内，调用方需持有锁
+func (m *tokenManager) fresh() bool {
+	return m.token != "" && time.Now().Before(m.refreshAt)
+}
+
+// set 保存新的token，调用方需持有锁
+// 提前刷新的时间不超过有效时长的一半，避免有效期较短时每次都触发刷新
+func (m *tokenManager) set(token string, expire time.Time) {
+	now := time.Now()
+	margin := m.margin
+	if half := expire.Sub(now) / 2; margin > half {
+		margin = half
+	}
+	m.token = token
+	m.expire = expire
+	m.refreshAt = expire.Add(-margin)
+}
+
+// refreshLocked 调用时需持有锁，返回时已释放锁
+// stale - 已知不可用的token，store中的同值token会被忽略
+// 刷新在独立的协程中进行，发起者与等待者都只按各自的ctx等待结果
+func (m *tokenManager) refreshLocked(ctx context.Context, stale string) (string, error) {
+	c := m.call
+	if c == nil {
+		c = &tokenCall{done: make(chan struct{})}
+		m.call = c
+		go m.run(ctx, c, stale)
+	}
+	m.mu.Unlock()
+	return c.wait(ctx)
+}
+
+// run 执行一次刷新并通知所有等待者
+// 使用不随发起者取消的ctx，避免发起者取消时其他等待者一起失败
+func (m *tokenManager) run(ctx context.Context, c *tokenCall, stale string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tokenFetchTimeout)
+	defer cancel()
+	token, expire, err := m.load(ctx, stale)
+
+	m.mu.Lock()
+	if err == nil {
+		m.set(token, expire)
+	}
+	c.token, c.err = token, err
+	m.call = nil
+	m.mu.Unlock()
+	close(c.done)
+}
+
+// load 优先复用store中的token，否则请求企业微信并写回store
+// 若store实现了TokenLocker，则在加锁后再次检查store，保证多进程间只有一个进程刷新
+func (m *tokenManager) load(ctx context.Context, stale string) (string, time.Time, error) {
+	if token, expire, ok := m.loadStore(ctx, stale); ok {
+		return token, expire, nil
+	}
+	if locker, ok := m.store.(TokenLocker); ok {
+		unlock, err := locker.Lock(ctx, m.key)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		defer unlock()
+		if token, expire, ok := m.loadStore(ctx, stale); ok {
+			return token, expire, nil
+		}
+	}
+	token, expiresIn, err := m.fetch(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expire := time.Now().Add(expiresIn)
+	// 写入失败不影响本进程使用新token，下次刷新时会再次写入
+	_ = m.store.Set(ctx, m.key, token, expire)
+	return token, expire, nil
+}
+
+// loadStore 从store中读取仍在安全有效期内的token
+func (m *tokenManager) loadStore(ctx context.Context, stale string) (string, time.Time, bool) {
+	token, expire, err := m.store.Get(ctx, m.key)
+	if err != nil || token == "" || token == stale {
+		return "", time.Time{}, false
+	}
+	if !time.Now().Add(m.margin).Before(expire) {
+		return "", time.Time{}, false
+	}
+	return token, expire, true
+}
+
+func (c *tokenCall) wait(ctx context.Context) (string, error) {
+	select {
+	case <-c.done:
+		return c.token, c.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,169 @@
+package wecom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TokenStore access_token的存储
+// 多个进程使用同一个共享存储时，同一corpid+secret只需维护一个token
+type TokenStore interface {
+	// Get 读取key对应的token及过期时间，不存在时返回空token
+	Get(ctx context.Context, key string) (string, time.Time, error)
+	// Set 保存key对应的token及过期时间
+	Set(ctx context.Context, key, token string, expire time.Time) error
+}
+
+// TokenLocker TokenStore的可选接口
+// 实现该接口的store会在刷新token前加锁，避免多个进程同时请求/gettoken
+type TokenLocker interface {
+	// Lock 对key加锁，返回解锁函数
+	Lock(ctx context.Context, key string) (func(), error)
+}
+
+// TokenKey 生成corpid+secret对应的存储键，secret以摘要形式出现，不会明文落盘
+func TokenKey(corpID, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return corpID + "_" + hex.EncodeToString(sum[:8])
+}
+
+// MemoryTokenStore 进程内的token存储，可在同一进程的多个客户端间共享
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]storedToken
+	locks  map[string]chan struct{}
+}
+
+type storedToken struct {
+	Token  string    `json:"token"`
+	Expire time.Time `json:"expire"`
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: make(map[string]storedToken),
+		locks:  make(map[string]chan struct{}),
+	}
+}
+
+func (s *MemoryTokenStore) Get(_ context.Context, key string) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.tokens[key]
+	return t.Token, t.Expire, nil
+}
+
+func (s *MemoryTokenStore) Set(_ context.Context, key, token string, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = storedToken{Token: token, Expire: expire}
+	return nil
+}
+
+func (s *MemoryTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = make(chan struct{}, 1)
+		s.locks[key] = l
+	}
+	s.mu.Unlock()
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// FileTokenStore 基于文件的token存储，同一台机器或共享目录上的多个进程可共享token
+// 每个key对应目录下的一个json文件，加锁通过独占创建.lock文件实现
+type FileTokenStore struct {
+	dir      string
+	lockWait time.Duration // 获取锁失败后的重试间隔
+	lockTTL  time.Duration // 锁文件超过该时间未释放则视为失效
+}
+
+func NewFileTokenStore(dir string) (*FileTokenStore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileTokenStore{
+		dir:      dir,
+		lockWait: 50 * time.Millisecond,
+		lockTTL:  30 * time.Second,
+	}, nil
+}
+
+func (s *FileTokenStore) Get(_ context.Context, key string) (string, time.Time, error) {
+	b, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", time.Time{}, nil
+		}
+		return "", time.Time{}, err
+	}
+	var t storedToken
+	err = json.Unmarshal(b, &t)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return t.Token, t.Expire, nil
+}
+
+// Set 先写临时文件再重命名，保证其他进程不会读到写了一半的内容
+func (s *FileTokenStore) Set(_ context.Context, key, token string, expire time.Time) error {
+	b, err := json.Marshal(storedToken{Token: token, Expire: expire})
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *FileTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	lockPath := s.path(key) + ".lock"
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		// 持有锁的进程可能已异常退出
+		if fi, err := os.Stat(lockPath); err == nil && time.Since(fi.ModTime()) > s.lockTTL {
+			_ = os.Remove(lockPath)
+			continue
+		}
+		select {
+		case <-time.After(s.lockWait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *FileTokenStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
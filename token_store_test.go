@@ -0,0 +1,135 @@
+package wecom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, expire, err := a.Get(ctx, "corp_key")
+	if err != nil || token != "" || !expire.IsZero() {
+		t.Fatalf("Get of missing key = %q, %v, %v", token, expire, err)
+	}
+	want := time.Now().Add(time.Hour).Round(time.Second)
+	if err = a.Set(ctx, "corp_key", "t1", want); err != nil {
+		t.Fatal(err)
+	}
+	token, expire, err = b.Get(ctx, "corp_key")
+	if err != nil || token != "t1" || !expire.Equal(want) {
+		t.Fatalf("Get from another store = %q, %v, %v", token, expire, err)
+	}
+}
+
+func TestFileTokenStoreLock(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.lockWait = 5 * time.Millisecond
+
+	unlock, err := a.Lock(context.Background(), "corp_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err = b.Lock(ctx, "corp_key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock while held = %v, want deadline exceeded", err)
+	}
+	unlock()
+	unlock, err = b.Lock(context.Background(), "corp_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	// 持有锁的进程异常退出，锁文件超过lockTTL后被接管
+	lockPath := a.path("corp_key") + ".lock"
+	if err = os.WriteFile(lockPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err = os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlock, err = b.Lock(ctx, "corp_key")
+	if err != nil {
+		t.Fatalf("Lock with stale lock file = %v", err)
+	}
+	unlock()
+	if _, err = os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("lock file not removed after unlock: %v", err)
+	}
+}
+
+// TestFileTokenStoreShared 模拟多个进程的客户端共享同一个目录，只获取一次token
+func TestFileTokenStoreShared(t *testing.T) {
+	var tokens int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gettoken" {
+			n := atomic.AddInt32(&tokens, 1)
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprintf(rw, `{"errcode":0,"errmsg":"ok","access_token":"t%d","expires_in":7200}`, n)
+			return
+		}
+		if r.URL.Query().Get("access_token") != "t1" {
+			fmt.Fprintf(rw, `{"errcode":%d,"errmsg":"invalid access_token"}`, ErrCodeInvalidAccessToken)
+			return
+		}
+		fmt.Fprint(rw, `{"errcode":0,"errmsg":"ok","userid":"zhangsan"}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	clients := make([]*Wecom, 3)
+	for i := range clients {
+		store, err := NewFileTokenStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients[i] = New("corp", "secret", WithBaseURL(srv.URL), WithRateLimiter(nil),
+			WithTokenStore(store), WithTokenRetry(false))
+	}
+	var wg sync.WaitGroup
+	for _, w := range clients {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(w *Wecom) {
+				defer wg.Done()
+				if _, err := w.UserGet("zhangsan"); err != nil {
+					t.Error(err)
+				}
+			}(w)
+		}
+	}
+	wg.Wait()
+	if tokens != 1 {
+		t.Fatalf("gettoken calls = %d, want 1", tokens)
+	}
+}
@@ -0,0 +1,182 @@
+package wecom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFetcher 每次调用返回新的token，release不为nil时等待其关闭后返回
+type countingFetcher struct {
+	calls   int32
+	ttl     time.Duration
+	started chan struct{}
+	release chan struct{}
+	ctxErr  error
+}
+
+func (f *countingFetcher) fetch(ctx context.Context) (string, time.Duration, error) {
+	n := atomic.AddInt32(&f.calls, 1)
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.release != nil {
+		<-f.release
+	}
+	f.ctxErr = ctx.Err()
+	return fmt.Sprintf("t%d", n), f.ttl, nil
+}
+
+func TestTokenManagerSingleFlight(t *testing.T) {
+	f := &countingFetcher{ttl: 2 * time.Hour, release: make(chan struct{})}
+	m := newTokenManager(f.fetch, defaultTokenMargin, NewMemoryTokenStore(), "key")
+
+	const n = 50
+	var wg sync.WaitGroup
+	tokens := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = m.Get(context.Background())
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(f.release)
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if errs[i] != nil || tokens[i] != "t1" {
+			t.Fatalf("caller %d: %q, %v", i, tokens[i], errs[i])
+		}
+	}
+	if f.calls != 1 {
+		t.Fatalf("fetch calls = %d, want 1", f.calls)
+	}
+}
+
+func TestTokenManagerLeaderCancel(t *testing.T) {
+	f := &countingFetcher{ttl: 2 * time.Hour, started: make(chan struct{}, 1), release: make(chan struct{})}
+	m := newTokenManager(f.fetch, defaultTokenMargin, NewMemoryTokenStore(), "key")
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := m.Get(leaderCtx)
+		leaderErr <- err
+	}()
+	<-f.started
+
+	type result struct {
+		token string
+		err   error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		token, err := m.Get(context.Background())
+		waiter <- result{token, err}
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// 发起者取消后只有发起者返回错误
+	cancel()
+	select {
+	case err := <-leaderErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("leader err = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		close(f.release)
+		t.Fatal("leader did not return after its ctx was cancelled")
+	}
+	close(f.release)
+	r := <-waiter
+	if r.err != nil || r.token != "t1" {
+		t.Fatalf("waiter = %q, %v", r.token, r.err)
+	}
+	if f.ctxErr != nil {
+		t.Errorf("fetch ctx was cancelled: %v", f.ctxErr)
+	}
+	if f.calls != 1 {
+		t.Errorf("fetch calls = %d, want 1", f.calls)
+	}
+	if token, _ := m.Current(); token != "t1" {
+		t.Errorf("cached token = %q, want t1", token)
+	}
+}
+
+func TestTokenManagerMargin(t *testing.T) {
+	tests := []struct {
+		ttl    time.Duration
+		margin time.Duration
+		want   time.Duration // 刷新时间距过期时间
+	}{
+		{2 * time.Hour, defaultTokenMargin, defaultTokenMargin},
+		{4 * time.Minute, defaultTokenMargin, 2 * time.Minute}, // 不超过有效时长的一半
+		{time.Hour, 0, 0},
+	}
+	for _, tt := range tests {
+		m := newTokenManager(nil, tt.margin, NewMemoryTokenStore(), "key")
+		expire := time.Now().Add(tt.ttl)
+		m.set("t", expire)
+		got := expire.Sub(m.refreshAt)
+		if d := got - tt.want; d < -time.Second || d > time.Second {
+			t.Errorf("ttl %v, margin %v: refresh %v before expiry, want %v", tt.ttl, tt.margin, got, tt.want)
+		}
+	}
+
+	// 有效期短于margin时，获取后的token在有效期一半内不会重复刷新
+	f := &countingFetcher{ttl: 4 * time.Minute}
+	m := newTokenManager(f.fetch, defaultTokenMargin, NewMemoryTokenStore(), "key")
+	for i := 0; i < 3; i++ {
+		if _, err := m.Get(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.calls != 1 {
+		t.Fatalf("fetch calls = %d, want 1", f.calls)
+	}
+}
+
+func TestTokenManagerInvalidate(t *testing.T) {
+	f := &countingFetcher{ttl: 2 * time.Hour}
+	m := newTokenManager(f.fetch, defaultTokenMargin, NewMemoryTokenStore(), "key")
+	ctx := context.Background()
+
+	t1, err := m.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := m.Invalidate(ctx, t1)
+	if err != nil || t2 != "t2" {
+		t.Fatalf("Invalidate(t1) = %q, %v", t2, err)
+	}
+	// 其他协程已刷新，过时的token不再触发请求
+	got, err := m.Invalidate(ctx, t1)
+	if err != nil || got != t2 || f.calls != 2 {
+		t.Fatalf("Invalidate(stale) = %q, %v, calls = %d", got, err, f.calls)
+	}
+
+	// 并发的失效请求只刷新一次
+	f.release = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := m.Invalidate(ctx, t2); err != nil || token != "t3" {
+				t.Errorf("Invalidate(t2) = %q, %v", token, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(f.release)
+	wg.Wait()
+	if f.calls != 3 {
+		t.Fatalf("fetch calls = %d, want 3", f.calls)
+	}
+}
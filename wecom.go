@@ -10,13 +10,14 @@ package wecom
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
-	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,22 +25,78 @@ const (
 	apiHost   = `qyapi.weixin.qq.com`
 	basePath  = `/cgi-bin`
 	https     = "https"
-	pathToken = `/gettoken`
+	pathToken = `gettoken`
 )
 
-func New(corpid, secret string) *Wecom {
-	return &Wecom{
-		corpID:     corpid,
-		corpSecret: secret,
+// New 创建企业微信客户端
+// opts - 可选配置，如http客户端、基础地址、超时时间等
+func New(corpid, secret string, opts ...Option) *Wecom {
+	w := &Wecom{
+		corpID:       corpid,
+		corpSecret:   secret,
+		tokenMargin:  defaultTokenMargin,
+		tokenRetry:   true,
+		limiter:      defaultLimiter,
+		freqRetries:  defaultFreqRetries,
+		freqBackoff:  defaultFreqBackoff,
+		secretRoutes: defaultSecretRoutes,
+		httpClient:   http.DefaultClient,
+		baseURL: &url.URL{
+			Scheme: https,
+			Host:   apiHost,
+			Path:   basePath,
+		},
+		oauthBaseURL: &url.URL{
+			Scheme: https,
+			Host:   OauthHost,
+		},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.transport != nil || w.timeout > 0 {
+		c := *w.httpClient
+		if w.transport != nil {
+			c.Transport = w.transport
+		}
+		if w.timeout > 0 {
+			c.Timeout = w.timeout
+		}
+		w.httpClient = &c
 	}
+	if w.tokenStore == nil {
+		w.tokenStore = NewMemoryTokenStore()
+	}
+	w.invoker = chainMiddlewares(w.middlewares, w.roundTrip)
+	w.tokens = w.newTokenManager(secret)
+	w.buildSecretTokens()
+	return w
 }
 
 type Wecom struct {
-	token       string
-	tokenExpire time.Time
-	corpID      string
-	corpSecret  string
-	debug       bool
+	tokens       *tokenManager
+	tokenMargin  time.Duration
+	tokenStore   TokenStore
+	tokenRetry   bool // token失效时是否自动刷新并重放请求
+	limiter      RateLimiter
+	middlewares  []Middleware
+	invoker      Invoker       // 组装好的中间件链
+	freqRetries  int           // 触发频率限制后的最大重试次数
+	freqBackoff  time.Duration // 触发频率限制后首次重试的等待时间
+	corpID       string
+	corpSecret   string
+	secrets      map[SecretName]string        // 各能力的secret
+	secretTokens map[SecretName]*tokenManager // 各能力secret对应的token管理器
+	secretRoutes []secretRoute
+	debug        bool
+
+	httpClient   *http.Client
+	transport    http.RoundTripper
+	timeout      time.Duration
+	baseURL      *url.URL
+	oauthBaseURL *url.URL
+	userAgent    string
+	optErr       error // 配置项产生的错误，在发起请求时返回
 }
 
 func (w *Wecom) Debug() {
@@ -48,10 +105,11 @@ func (w *Wecom) Debug() {
 
 // Check 本地校验对象的可用性
 func (w *Wecom) Check() error {
-	if w.token == "" {
+	token, expire := w.tokens.Current()
+	if token == "" {
 		return errors.New("token is nil")
 	}
-	if time.Now().Unix() > w.tokenExpire.Unix() {
+	if time.Now().Unix() > expire.Unix() {
 		return errors.New("token expired")
 	}
 	if w.corpID == "" || w.corpSecret == "" {
@@ -60,16 +118,27 @@ func (w *Wecom) Check() error {
 	return nil
 }
 
-// CheckAndAuth 如果校验不通过则发起认证
+// CheckAndAuth 如果token不存在或即将过期则发起认证
+// 并发调用时只会发起一次认证请求
 func (w *Wecom) CheckAndAuth() error {
-	if w.Check() == nil {
-		return nil
-	}
-	err := w.Auth()
-	if err != nil {
-		return err
-	}
-	return nil
+	return w.CheckAndAuthContext(context.Background())
+}
+
+// CheckAndAuthContext 同CheckAndAuth，支持通过ctx取消请求或设置超时
+func (w *Wecom) CheckAndAuthContext(ctx context.Context) error {
+	_, err := w.tokens.Get(ctx)
+	return err
+}
+
+// AccessToken 返回当前可用的access_token，必要时自动刷新
+// 可供其他需要直接使用token的组件调用
+func (w *Wecom) AccessToken() (string, error) {
+	return w.AccessTokenContext(context.Background())
+}
+
+// AccessTokenContext 同AccessToken，支持通过ctx取消请求或设置超时
+func (w *Wecom) AccessTokenContext(ctx context.Context) (string, error) {
+	return w.tokens.Get(ctx)
 }
 
 func (w *Wecom) NewAesKey() string {
@@ -78,165 +147,177 @@ func (w *Wecom) NewAesKey() string {
 
 // Auth 获取并设置企业微信token
 func (w *Wecom) Auth() error {
-	queryVal := url.Values{}
-	queryVal.Add("corpid", w.corpID)
-	queryVal.Add("corpsecret", w.corpSecret)
-
-	tokenUrl := &url.URL{
-		Scheme: https,
-		Host:   apiHost,
-		Path:   path.Join(basePath, pathToken),
-	}
-	tokenUrl.RawQuery = queryVal.Encode()
+	return w.AuthContext(context.Background())
+}
 
-	header := http.Header{}
-	header.Set("Content-type", "application/json")
+// AuthContext 同Auth，支持通过ctx取消请求或设置超时
+func (w *Wecom) AuthContext(ctx context.Context) error {
+	_, err := w.tokens.Refresh(ctx)
+	return err
+}
 
-	req := &http.Request{
-		Method: http.MethodGet,
-		URL:    tokenUrl,
-		Header: header,
-	}
+// fetchToken 请求企业微信获取secret对应的新token，返回token与有效时长
+func (w *Wecom) fetchToken(ctx context.Context, secret string) (string, time.Duration, error) {
+	queryVal := url.Values{}
+	queryVal.Add("corpid", w.corpID)
+	queryVal.Add("corpsecret", secret)
 
-	resp, err := http.DefaultClient.Do(req)
+	req, err := w.newRequest(ctx, http.MethodGet, pathToken, queryVal, nil)
 	if err != nil {
-		return err
+		return "", 0, err
 	}
-	respBytes, err := io.ReadAll(resp.Body)
+	req.Header.Set("Content-type", "application/json")
+
+	err = w.wait(ctx, pathToken, TokenKey(w.corpID, secret))
 	if err != nil {
-		return err
+		return "", 0, err
 	}
 	var token struct {
-		Errcode     int    `json:"errcode"`      // 企业微信错误码，正常时为0
-		Errmsg      string `json:"errmsg"`       // 企业微信错误信息，正常时为"ok"
+		Error
 		AccessToken string `json:"access_token"` // Token内容
 		ExpiresIn   int    `json:"expires_in"`   // token有效时间（秒）
 	}
-	err = json.Unmarshal(respBytes, &token)
-	if err != nil {
-		return err
+	call := &CallInfo{
+		Method:  http.MethodGet,
+		Path:    pathToken,
+		Attempt: 1,
+		Request: req,
+		result:  &token,
 	}
-	if token.Errcode != 0 {
-		return errors.New(token.Errmsg)
+	err = w.invoker(ctx, call)
+	if err != nil {
+		return "", 0, err
 	}
-	w.token = token.AccessToken
-	w.tokenExpire = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
-	return nil
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
 }
 
-// get 通用的get方法,返回body内容或错误
+// get 通用的get方法，响应解析到out中
 // p - 请求路径
 // query - 请求的url-query
-func (w *Wecom) get(p string, query url.Values) (map[string]json.RawMessage, error) {
-	if query == nil {
-		query = url.Values{}
-	}
-	query.Add("access_token", w.token)
-	if w.debug {
-		query.Add("debug", "1")
-	}
-	req := &http.Request{
-		Method: http.MethodGet,
-		URL: &url.URL{
-			Scheme:   "https",
-			Host:     apiHost,
-			Path:     path.Join(basePath, p),
-			RawQuery: query.Encode(),
-		},
-	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	mpBytes, err := parseResponseBody(bodyBytes)
-	if err != nil {
-		return nil, err
-	}
-	return mpBytes, nil
+// out - 响应结构，需内嵌Error；为nil时只校验错误码
+func (w *Wecom) get(ctx context.Context, p string, query url.Values, out any) error {
+	return w.do(ctx, http.MethodGet, p, query, nil, out)
 }
 
-// post 通用post请求,返回body内容或错误
-func (w *Wecom) post(p string, b interface{}) (map[string]json.RawMessage, error) {
-	query := url.Values{}
-	query.Add("access_token", w.token)
-	if w.debug {
-		query.Add("debug", "1")
-	}
-	req := &http.Request{
-		Method: http.MethodPost,
-		URL: &url.URL{
-			Scheme:   "https",
-			Host:     apiHost,
-			Path:     path.Join(basePath, p),
-			RawQuery: query.Encode(),
-		},
-	}
-	bb, err := json.Marshal(b)
-	if err != nil {
-		return nil, err
-	}
-	reqBodyMap := make(map[string]json.RawMessage)
-	err = json.Unmarshal(bb, &reqBodyMap)
-	if err != nil {
-		return nil, err
-	}
-	//reqBodyMap["access_token"] = []byte(w.token)
-	body, _ := json.Marshal(reqBodyMap)
-	req.Body = io.NopCloser(bytes.NewReader(body))
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	bodyBytes, err := io.ReadAll(resp.Body)
+// post 通用post请求，请求体b序列化为json，响应解析到out中
+func (w *Wecom) post(ctx context.Context, p string, b any, out any) error {
+	body, err := json.Marshal(b)
 	if err != nil {
-		return nil, err
-	}
-	mpBytes, err := parseResponseBody(bodyBytes)
-	if err != nil {
-		return nil, err
+		return err
 	}
-	return mpBytes, nil
+	return w.do(ctx, http.MethodPost, p, nil, body, out)
 }
 
-func parseResponseBody(body []byte) (map[string]json.RawMessage, error) {
-	var r = make(map[string]json.RawMessage)
-	err := json.Unmarshal(body, &r)
+// do 携带token发起请求并解析响应
+// - 每次尝试都会经过中间件链
+// - 请求前经过限流器，超出频率时等待
+// - 若企业微信返回token失效的错误码，则刷新token后重放一次原请求
+// - 若企业微信返回频率限制的错误码，则按指数退避重试
+// - 响应一次性解析到out中
+// p统一去掉开头的"/"，中间件、限流器与secret路由看到的路径格式一致
+func (w *Wecom) do(ctx context.Context, method, p string, query url.Values, body []byte, out any) error {
+	p = strings.TrimPrefix(p, "/")
+	tokens := w.tokenFor(p)
+	token, err := tokens.Get(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var ecode Error
-	var rb = make(map[string]json.RawMessage)
-	for k, v := range r {
-		if k == "errcode" {
-			ec, _ := strconv.Atoi(string(v))
-			ecode.Errcode = ec
-			continue
+	tokenRetried := false
+	freqRetries := 0
+	for attempt := 1; ; attempt++ {
+		err = w.wait(ctx, p, tokens.key)
+		if err != nil {
+			return err
 		}
-		if k == "errmsg" {
-			ecode.Errmsg = string(v)
-			continue
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("access_token", token)
+		if w.debug {
+			q.Set("debug", "1")
+		}
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := w.newRequest(ctx, method, p, q, reqBody)
+		if err != nil {
+			return err
+		}
+		call := &CallInfo{
+			Method:      method,
+			Path:        p,
+			Attempt:     attempt,
+			Request:     req,
+			RequestBody: body,
+			result:      out,
+		}
+		err = w.invoker(ctx, call)
+		if err == nil {
+			return nil
+		}
+		switch {
+		case !tokenRetried && w.tokenRetry && isTokenInvalid(call.Errcode):
+			tokenRetried = true
+			token, err = tokens.Invalidate(ctx, token)
+			if err != nil {
+				return err
+			}
+		case freqRetries < w.freqRetries && isFrequencyLimited(call.Errcode):
+			freqRetries++
+			err = sleepContext(ctx, backoffDelay(w.freqBackoff, maxFreqBackoff, freqRetries))
+			if err != nil {
+				return err
+			}
+		default:
+			return err
 		}
-		rb[k] = v
 	}
-	err = ecode.Check()
-	if err != nil {
-		return nil, err
+}
+
+// wait 经过限流器，未配置限流器时直接返回
+// app - 应用标识，即调用使用的secret对应的TokenKey
+func (w *Wecom) wait(ctx context.Context, p, app string) error {
+	if w.limiter == nil {
+		return nil
 	}
-	return rb, nil
+	return w.limiter.Wait(ctx, RateTarget{
+		CorpID: w.corpID,
+		App:    app,
+		Path:   p,
+	})
 }
 
-func umarshalObject(data map[string]json.RawMessage, obj interface{}) error {
-	datab, err := json.Marshal(data)
-	if err != nil {
-		return err
+// isTokenInvalid 判断错误码是否表示access_token不合法或已过期
+func isTokenInvalid(errcode int) bool {
+	switch ErrCode(errcode) {
+	case ErrCodeInvalidSecret, ErrCodeInvalidAccessToken, ErrCodeAccessTokenExpired:
+		return true
+	}
+	return false
+}
+
+// newRequest 基于客户端的基础地址构建请求
+// p - 相对于基础地址的路径
+func (w *Wecom) newRequest(ctx context.Context, method, p string, query url.Values, body io.Reader) (*http.Request, error) {
+	if w.optErr != nil {
+		return nil, w.optErr
 	}
-	err = json.Unmarshal(datab, obj)
+	u := *w.baseURL
+	u.Path = path.Join(u.Path, p)
+	u.RawQuery = query.Encode()
+	return w.newRawRequest(ctx, method, u.String(), body)
+}
+
+// newRawRequest 构建指向任意地址的请求，如导出文件的下载地址
+func (w *Wecom) newRawRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	if w.userAgent != "" {
+		req.Header.Set("User-Agent", w.userAgent)
+	}
+	return req, nil
 }
@@ -0,0 +1,274 @@
+package wecomtest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-common/wecom"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// importMedia 模拟上传的导入csv文件内容
+type importMedia struct {
+	users       []wecom.User
+	departments []wecom.Department
+}
+
+// job 异步任务
+type job struct {
+	typ      string
+	total    int
+	result   any               // 导入任务的处理结果
+	dataList []wecom.ExportUrl // 导出任务的数据文件
+}
+
+func init() {
+	handlers["batch/syncuser"] = (*Server).batchSyncUser
+	handlers["batch/replaceuser"] = (*Server).batchReplaceUser
+	handlers["batch/replaceparty"] = (*Server).batchReplaceParty
+	handlers["batch/getresult"] = (*Server).batchGetResult
+
+	handlers["export/simple_user"] = (*Server).exportSimpleUser
+	handlers["export/user"] = (*Server).exportUser
+	handlers["export/department"] = (*Server).exportDepartment
+	handlers["export/taguser"] = (*Server).exportTagUser
+	handlers["export/get_result"] = (*Server).exportGetResult
+}
+
+// AddImportMedia 预置导入文件，代替素材上传接口返回的media_id
+// 成员文件传入users，部门文件传入departments
+func (s *Server) AddImportMedia(mediaID string, users []wecom.User, departments []wecom.Department) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.media[mediaID] = &importMedia{users: users, departments: departments}
+}
+
+func (s *Server) batchSyncUser(r *apiRequest) (result, *apiError) {
+	return s.importUsers(r, wecom.JobTypeSyncUser)
+}
+
+func (s *Server) batchReplaceUser(r *apiRequest) (result, *apiError) {
+	return s.importUsers(r, wecom.JobTypeReplaceUser)
+}
+
+func (s *Server) importUsers(r *apiRequest, typ string) (result, *apiError) {
+	req, m, e := s.importMedia(r)
+	if e != nil {
+		return nil, e
+	}
+	keep := make(map[string]bool, len(m.users))
+	results := make([]wecom.ImportUserResult, 0, len(m.users))
+	for _, u := range m.users {
+		res := wecom.ImportUserResult{UserID: u.UserID}
+		if ae := s.checkDepartments(u.Department); ae != nil {
+			res.Errcode, res.Errmsg = ae.code, ae.msg
+		} else {
+			u := u
+			if u.Status == 0 {
+				u.Status = 4
+			}
+			s.users[u.UserID] = &u
+			keep[u.UserID] = true
+		}
+		results = append(results, res)
+	}
+	// 全量覆盖时删除文件中不存在的成员
+	if typ == wecom.JobTypeReplaceUser {
+		for userid := range s.users {
+			if !keep[userid] {
+				delete(s.users, userid)
+			}
+		}
+	}
+	jobid := s.nextID("job")
+	s.jobs[jobid] = &job{typ: typ, total: len(results), result: results}
+	s.notifyBatchJob(req.Callback, jobid, typ)
+	return result{"jobid": jobid}, nil
+}
+
+func (s *Server) batchReplaceParty(r *apiRequest) (result, *apiError) {
+	req, m, e := s.importMedia(r)
+	if e != nil {
+		return nil, e
+	}
+	departments := make(map[int]*wecom.Department, len(m.departments))
+	results := make([]wecom.ImportPartyResult, 0, len(m.departments))
+	for _, d := range m.departments {
+		d := d
+		action := 1
+		if _, ok := s.departments[d.Id]; ok {
+			action = 2
+		}
+		departments[d.Id] = &d
+		results = append(results, wecom.ImportPartyResult{Action: action, PartyID: d.Id})
+	}
+	if _, ok := departments[1]; !ok {
+		departments[1] = s.departments[1]
+	}
+	s.departments = departments
+	jobid := s.nextID("job")
+	s.jobs[jobid] = &job{typ: wecom.JobTypeReplaceParty, total: len(results), result: results}
+	s.notifyBatchJob(req.Callback, jobid, wecom.JobTypeReplaceParty)
+	return result{"jobid": jobid}, nil
+}
+
+func (s *Server) importMedia(r *apiRequest) (*wecom.Import, *importMedia, *apiError) {
+	var req wecom.Import
+	if r.decode(&req) != nil || req.MediaID == "" {
+		return nil, nil, errInvalidParam
+	}
+	m, ok := s.media[req.MediaID]
+	if !ok {
+		return nil, nil, fail(wecom.ErrCodeInvalidParam, "invalid media_id")
+	}
+	return &req, m, nil
+}
+
+func (s *Server) batchGetResult(r *apiRequest) (result, *apiError) {
+	j, ok := s.jobs[r.query.Get("jobid")]
+	if !ok || j.result == nil {
+		return nil, fail(wecom.ErrCodeInvalidParam, "invalid jobid")
+	}
+	return result{
+		"status":     3,
+		"type":       j.typ,
+		"total":      j.total,
+		"percentage": 100,
+		"result":     j.result,
+	}, nil
+}
+
+// exportRequest 导出接口的请求
+type exportRequest struct {
+	EncodingAESKey string `json:"encoding_aeskey"`
+	BlockSize      int    `json:"block_size"`
+	TagID          int    `json:"tagid"`
+}
+
+func (s *Server) exportSimpleUser(r *apiRequest) (result, *apiError) {
+	return s.export(r, wecom.JobTypeExportSimpleUser, func(*exportRequest) (any, *apiError) {
+		users := s.sortedUsers()
+		list := make([]wecom.User, 0, len(users))
+		for _, u := range users {
+			list = append(list, wecom.User{UserID: u.UserID, Name: u.Name, Department: u.Department})
+		}
+		return list, nil
+	})
+}
+
+func (s *Server) exportUser(r *apiRequest) (result, *apiError) {
+	return s.export(r, wecom.JobTypeExportUser, func(*exportRequest) (any, *apiError) {
+		return s.sortedUsers(), nil
+	})
+}
+
+func (s *Server) exportDepartment(r *apiRequest) (result, *apiError) {
+	return s.export(r, wecom.JobTypeExportDepartment, func(*exportRequest) (any, *apiError) {
+		list, e := s.subDepartments(&apiRequest{})
+		return list, e
+	})
+}
+
+func (s *Server) exportTagUser(r *apiRequest) (result, *apiError) {
+	return s.export(r, wecom.JobTypeExportTagUser, func(req *exportRequest) (any, *apiError) {
+		td, ok := s.tags[req.TagID]
+		if !ok {
+			return nil, fail(wecom.ErrCodeInvalidTagID, "tag not found")
+		}
+		list := wecom.TagMemberList{TagName: td.tag.Tagname, PartyList: td.parties}
+		for _, userid := range td.users {
+			if u, ok := s.users[userid]; ok {
+				list.UserList = append(list.UserList, wecom.User{UserID: u.UserID, Name: u.Name, Department: u.Department})
+			}
+		}
+		return list, nil
+	})
+}
+
+// export 生成加密的导出文件，任务立即完成
+func (s *Server) export(r *apiRequest, typ string, data func(*exportRequest) (any, *apiError)) (result, *apiError) {
+	var req exportRequest
+	if r.decode(&req) != nil {
+		return nil, errInvalidParam
+	}
+	key, err := decodeAESKey(req.EncodingAESKey)
+	if err != nil {
+		return nil, fail(wecom.ErrCodeInvalidParam, "invalid encoding_aeskey")
+	}
+	v, e := data(&req)
+	if e != nil {
+		return nil, e
+	}
+	plain, _ := json.Marshal(v)
+	cipher, err := encryptCBC(key, plain)
+	if err != nil {
+		return nil, fail(wecom.ErrCodeSystemBusy, "encrypt: %v", err)
+	}
+	jobid := s.nextID("job")
+	s.downloads[jobid] = cipher
+	s.jobs[jobid] = &job{
+		typ: typ,
+		dataList: []wecom.ExportUrl{{
+			Url:  s.URL + downloadPath + jobid,
+			Size: len(cipher),
+			Md5:  fmt.Sprintf("%x", md5.Sum(cipher)),
+		}},
+	}
+	s.notifyBatchJob(nil, jobid, typ)
+	return result{"jobid": jobid}, nil
+}
+
+func (s *Server) exportGetResult(r *apiRequest) (result, *apiError) {
+	j, ok := s.jobs[r.query.Get("jobid")]
+	if !ok || j.dataList == nil {
+		return nil, fail(wecom.ErrCodeInvalidParam, "invalid jobid")
+	}
+	return result{"status": 2, "data_list": j.dataList}, nil
+}
+
+// serveDownload 下载导出文件，支持Range分段下载
+func (s *Server) serveDownload(rw http.ResponseWriter, r *http.Request) {
+	jobid := strings.TrimPrefix(r.URL.Path, downloadPath)
+	s.mu.Lock()
+	data, ok := s.downloads[jobid]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+	http.ServeContent(rw, r, jobid, time.Time{}, bytes.NewReader(data))
+}
+
+// decodeAESKey 解析encoding_aeskey为32字节的AESKey
+// 兼容标准Base64与URL安全的Base64编码
+func decodeAESKey(encodingAESKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		key, err = base64.RawURLEncoding.DecodeString(encodingAESKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid aeskey length %d", len(key))
+	}
+	return key, nil
+}
+
+// encryptCBC AES-256-CBC加密，IV取key前16字节，PKCS#7填充至32字节的倍数
+func encryptCBC(key, plain []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	pad := 32 - len(plain)%32
+	data := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, key[:16]).CryptBlocks(data, data)
+	return data, nil
+}
@@ -0,0 +1,238 @@
+package wecomtest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/golang-common/wecom"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CallbackConfig 应用接收事件的回调配置，对应管理后台"接收事件服务器"的设置
+type CallbackConfig struct {
+	URL            string
+	Token          string
+	EncodingAESKey string
+	AgentID        string
+}
+
+// SetCallback 设置回调地址，通讯录变更与异步任务完成时向其推送加密的事件
+func (s *Server) SetCallback(cfg CallbackConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callback = &cfg
+}
+
+// WaitCallbacks 等待所有进行中的回调推送完成
+func (s *Server) WaitCallbacks() {
+	s.pending.Wait()
+}
+
+// CallbackErrors 返回推送失败的错误，回调地址返回非2xx状态码也视为失败
+func (s *Server) CallbackErrors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.cbErrs...)
+}
+
+// PushEvent 向回调地址推送自定义事件，body为明文的xml消息
+func (s *Server) PushEvent(body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.push(s.callback, body)
+}
+
+// callbackField 事件xml中的一个字段
+type callbackField struct {
+	name  string
+	value string
+}
+
+// notifyUser 推送成员变更事件，调用方需持有锁
+func (s *Server) notifyUser(changeType string, u *wecom.User) {
+	s.notifyChange(changeType,
+		callbackField{"UserID", u.UserID},
+		callbackField{"Name", u.Name},
+		callbackField{"Department", joinInts(u.Department)},
+		callbackField{"MainDepartment", strconv.Itoa(u.MainDepartment)},
+		callbackField{"IsLeaderInDept", joinInts(u.IsLeaderInDept)},
+		callbackField{"DirectLeader", strings.Join(u.DirectLeader, ",")},
+		callbackField{"Position", u.Position},
+		callbackField{"Mobile", u.Mobile},
+		callbackField{"Gender", u.Gender},
+		callbackField{"Email", u.Email},
+		callbackField{"BizMail", u.BizMail},
+		callbackField{"Status", strconv.Itoa(u.Status)},
+		callbackField{"Avatar", u.Avatar},
+		callbackField{"Alias", u.Alias},
+		callbackField{"Telephone", u.Telephone},
+		callbackField{"Address", u.Address},
+	)
+}
+
+// notifyParty 推送部门变更事件，调用方需持有锁
+func (s *Server) notifyParty(changeType string, d *wecom.Department) {
+	s.notifyChange(changeType,
+		callbackField{"Id", strconv.Itoa(d.Id)},
+		callbackField{"Name", d.Name},
+		callbackField{"ParentId", strconv.Itoa(d.ParentId)},
+		callbackField{"Order", strconv.Itoa(d.Order)},
+	)
+}
+
+// notifyTag 推送标签成员变更事件，调用方需持有锁
+func (s *Server) notifyTag(tagID int, add bool, users []string, parties []int) {
+	if len(users)+len(parties) == 0 {
+		return
+	}
+	userItems, partyItems := "AddUserItems", "AddPartyItems"
+	if !add {
+		userItems, partyItems = "DelUserItems", "DelPartyItems"
+	}
+	s.notifyChange("update_tag",
+		callbackField{"TagId", strconv.Itoa(tagID)},
+		callbackField{userItems, strings.Join(users, ",")},
+		callbackField{partyItems, joinInts(parties)},
+	)
+}
+
+// notifyEvent 推送只包含少量字段的变更事件，调用方需持有锁
+func (s *Server) notifyEvent(changeType string, fields map[string]string) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]callbackField, 0, len(names))
+	for _, name := range names {
+		list = append(list, callbackField{name, fields[name]})
+	}
+	s.notifyChange(changeType, list...)
+}
+
+func (s *Server) notifyChange(changeType string, fields ...callbackField) {
+	if s.callback == nil {
+		return
+	}
+	fields = append([]callbackField{{"ChangeType", changeType}}, fields...)
+	s.push(s.callback, s.eventXML("change_contact", fields, ""))
+}
+
+// notifyBatchJob 推送异步任务完成事件，导入任务指定了回调时推送到该地址，调用方需持有锁
+func (s *Server) notifyBatchJob(cb *wecom.ImportCallback, jobid, jobType string) {
+	cfg := s.callback
+	if cb != nil && cb.Url != "" {
+		cfg = &CallbackConfig{URL: cb.Url, Token: cb.Token, EncodingAESKey: cb.Encodingaeskey}
+	}
+	if cfg == nil {
+		return
+	}
+	inner := fmt.Sprintf("<BatchJob><JobId><![CDATA[%s]]></JobId><JobType><![CDATA[%s]]></JobType>"+
+		"<ErrCode>0</ErrCode><ErrMsg><![CDATA[ok]]></ErrMsg></BatchJob>", jobid, jobType)
+	s.push(cfg, s.eventXML("batch_job_result", nil, inner))
+}
+
+// eventXML 构建明文的事件消息
+func (s *Server) eventXML(event string, fields []callbackField, inner string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<xml>")
+	fmt.Fprintf(&buf, "<ToUserName><![CDATA[%s]]></ToUserName>", s.corpID)
+	buf.WriteString("<FromUserName><![CDATA[sys]]></FromUserName>")
+	fmt.Fprintf(&buf, "<CreateTime>%d</CreateTime>", time.Now().Unix())
+	buf.WriteString("<MsgType><![CDATA[event]]></MsgType>")
+	fmt.Fprintf(&buf, "<Event><![CDATA[%s]]></Event>", event)
+	for _, f := range fields {
+		fmt.Fprintf(&buf, "<%s><![CDATA[%s]]></%s>", f.name, f.value, f.name)
+	}
+	buf.WriteString(inner)
+	buf.WriteString("</xml>")
+	return buf.Bytes()
+}
+
+// push 加密并异步推送事件，调用方需持有锁
+func (s *Server) push(cfg *CallbackConfig, body []byte) {
+	if cfg == nil || cfg.URL == "" {
+		return
+	}
+	req, err := s.callbackRequest(cfg, body)
+	if err != nil {
+		s.cbErrs = append(s.cbErrs, err)
+		return
+	}
+	client := s.Server.Client()
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		err := send(client, req)
+		if err != nil {
+			s.mu.Lock()
+			s.cbErrs = append(s.cbErrs, err)
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// callbackEnvelope 推送到回调地址的加密消息
+type callbackEnvelope struct {
+	XMLName    xml.Name `xml:"xml"`
+	ToUserName string   `xml:"ToUserName"`
+	Encrypt    string   `xml:"Encrypt"`
+	AgentID    string   `xml:"AgentID"`
+}
+
+func (s *Server) callbackRequest(cfg *CallbackConfig, body []byte) (*http.Request, error) {
+	crypt, err := wecom.NewMsgCrypt(cfg.Token, cfg.EncodingAESKey, s.corpID)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := crypt.Encrypt(body)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := s.nextID("nonce")
+	b, err := xml.Marshal(callbackEnvelope{ToUserName: s.corpID, Encrypt: encrypted, AgentID: cfg.AgentID})
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("msg_signature", crypt.Signature(timestamp, nonce, encrypted))
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", nonce)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	return req, nil
+}
+
+func send(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback %s%s: status %d", req.URL.Host, req.URL.Path, resp.StatusCode)
+	}
+	return nil
+}
+
+func joinInts(list []int) string {
+	s := make([]string, len(list))
+	for i, v := range list {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
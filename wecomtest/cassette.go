@@ -0,0 +1,253 @@
+package wecomtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-common/wecom"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Mode 录制器的工作模式
+type Mode int
+
+const (
+	ModeReplay Mode = iota // 回放：只从录像文件中返回响应，未匹配的请求返回错误
+	ModeRecord             // 录制：请求真实服务，并在Save时写入录像文件
+)
+
+// Cassette 录像文件的内容
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction 一次请求与响应
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest 脱敏后的请求
+type RecordedRequest struct {
+	Method  string          `json:"method"`
+	URL     string          `json:"url"`
+	Body    json.RawMessage `json:"body,omitempty"`     // json格式的body
+	RawBody []byte          `json:"raw_body,omitempty"` // 非json格式的body
+}
+
+// RecordedResponse 脱敏后的响应
+type RecordedResponse struct {
+	StatusCode  int             `json:"status_code"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`     // json格式的body
+	RawBody     []byte          `json:"raw_body,omitempty"` // 非json格式的body，如导出的加密文件
+}
+
+// Recorder 录制与回放企业微信请求的RoundTripper
+// 录制时url中的access_token、corpsecret、code，body中的token、手机号、邮箱等字段均会脱敏，
+// 回放时请求按method、脱敏后的url与body匹配，因此不依赖真实的token。
+// 导出文件等非json内容原样保存，其中的数据仍需测试时传入的aeskey才能解密
+//
+//	rec, err := wecomtest.NewRecorder("testdata/user_get.json", wecomtest.ModeReplay)
+//	w := wecom.New("ww-corp", "secret", rec.Option())
+//	u, err := w.UserGet("zhangsan")
+type Recorder struct {
+	mu        sync.Mutex
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	fields    []string
+	cassette  Cassette
+	used      []bool
+}
+
+// RecorderOption 录制器配置项
+type RecorderOption func(*Recorder)
+
+// RecorderTransport 设置录制时实际发起请求的RoundTripper，默认http.DefaultTransport
+func RecorderTransport(rt http.RoundTripper) RecorderOption {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// RecorderScrubFields 额外需要脱敏的json字段，如name、position
+func RecorderScrubFields(fields ...string) RecorderOption {
+	return func(r *Recorder) {
+		r.fields = append(r.fields, fields...)
+	}
+}
+
+// NewRecorder 创建录制器，回放模式下读取录像文件
+func NewRecorder(path string, mode Mode, opts ...RecorderOption) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(b, &r.cassette)
+		if err != nil {
+			return nil, fmt.Errorf("cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Option 返回使用该录制器发起请求的客户端配置
+func (r *Recorder) Option() wecom.Option {
+	return wecom.WithTransport(r)
+}
+
+// Cassette 返回当前录制或加载的内容
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save 将录制的内容写入录像文件，回放模式下不做任何操作
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	r.mu.Lock()
+	err := enc.Encode(r.cassette)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(r.path), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, buf.Bytes(), 0o644)
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	recorded := RecordedRequest{Method: req.Method, URL: wecom.RedactURL(req.URL)}
+	recorded.Body, recorded.RawBody = r.scrub(body)
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+	return r.record(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	out := RecordedResponse{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	out.Body, out.RawBody = r.scrub(b)
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{Request: recorded, Response: out})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// replay 返回第一个未使用的匹配记录，匹配记录均已使用时返回最后一个
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := -1
+	for i, it := range r.cassette.Interactions {
+		if !matchRequest(it.Request, recorded) {
+			continue
+		}
+		found = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("wecomtest: no recorded interaction for %s %s", recorded.Method, recorded.URL)
+	}
+	r.used[found] = true
+	res := r.cassette.Interactions[found].Response
+	body := []byte(res.Body)
+	if res.RawBody != nil {
+		body = res.RawBody
+	}
+	header := make(http.Header)
+	if res.ContentType != "" {
+		header.Set("Content-Type", res.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode)),
+		StatusCode:    res.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// scrub 脱敏body，json内容返回脱敏后的json，其余内容原样返回
+func (r *Recorder) scrub(b []byte) (json.RawMessage, []byte) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	rb, err := wecom.RedactJSON(b, r.fields...)
+	if err != nil {
+		return nil, b
+	}
+	return rb, nil
+}
+
+func matchRequest(a, b RecordedRequest) bool {
+	return a.Method == b.Method &&
+		a.URL == b.URL &&
+		bytes.Equal(compactJSON(a.Body), compactJSON(b.Body)) &&
+		bytes.Equal(a.RawBody, b.RawBody)
+}
+
+// compactJSON 去除格式化录像文件时引入的空白
+func compactJSON(b json.RawMessage) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, b) != nil {
+		return b
+	}
+	return buf.Bytes()
+}
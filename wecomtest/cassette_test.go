@@ -0,0 +1,100 @@
+package wecomtest_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/golang-common/wecom"
+	"github.com/golang-common/wecom/wecomtest"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "重新生成testdata中的录像文件")
+
+const cassettePath = "testdata/user_get.json"
+
+// hostTransport 将请求转发到模拟服务，录像中保留默认的企业微信地址
+type hostTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = ""
+	return t.next.RoundTrip(req)
+}
+
+func TestCassetteRoundTrip(t *testing.T) {
+	srv := wecomtest.NewServer(testCorpID, testSecret)
+	srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}, Mobile: "13800000000", Email: "zhangsan@example.com"})
+	target, _ := url.Parse(srv.URL)
+
+	// 录制：请求模拟服务，敏感字段脱敏后写入录像文件
+	path := filepath.Join(t.TempDir(), "user_get.json")
+	rec, err := wecomtest.NewRecorder(path, wecomtest.ModeRecord,
+		wecomtest.RecorderTransport(hostTransport{target: target, next: srv.Server.Client().Transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wecom.New(testCorpID, testSecret, rec.Option(), wecom.WithRateLimiter(nil))
+	u, err := w.UserGet("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Mobile != "13800000000" {
+		t.Fatalf("recording should return the real response, got %+v", u)
+	}
+	if err = rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	recorded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{testSecret, "13800000000", "zhangsan@example.com"} {
+		if strings.Contains(string(recorded), `"`+secret+`"`) || strings.Contains(string(recorded), "="+secret) {
+			t.Errorf("cassette leaks %q:\n%s", secret, recorded)
+		}
+	}
+	if *update {
+		if err = os.MkdirAll(filepath.Dir(cassettePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(cassettePath, recorded, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(cassettePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recorded, golden) {
+		t.Fatalf("recorded cassette differs from %s, run with -update:\n%s", cassettePath, recorded)
+	}
+
+	// 回放：模拟服务已关闭，只使用录像文件中的响应
+	rep, err := wecomtest.NewRecorder(cassettePath, wecomtest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = wecom.New(testCorpID, testSecret, rep.Option(), wecom.WithRateLimiter(nil))
+	u, err = w.UserGet("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.UserID != "zhangsan" || u.Name != "张三" || u.Mobile != "***" || u.Email != "***" {
+		t.Fatalf("replayed user = %+v", u)
+	}
+	if _, err = w.UserGet("lisi"); err == nil {
+		t.Fatal("expected error for request not in cassette")
+	}
+}
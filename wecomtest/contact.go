@@ -0,0 +1,734 @@
+package wecomtest
+
+import (
+	"github.com/golang-common/wecom"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tagData 标签及其成员
+type tagData struct {
+	tag     wecom.Tag
+	users   []string
+	parties []int
+}
+
+func init() {
+	handlers["user/create"] = (*Server).userCreate
+	handlers["user/get"] = (*Server).userGet
+	handlers["user/update"] = (*Server).userUpdate
+	handlers["user/delete"] = (*Server).userDelete
+	handlers["user/batchdelete"] = (*Server).userBatchDelete
+	handlers["user/simplelist"] = (*Server).userSimpleList
+	handlers["user/list"] = (*Server).userList
+	handlers["user/list_id"] = (*Server).userListID
+	handlers["user/convert_to_openid"] = (*Server).userConvertToOpenID
+	handlers["user/convert_to_userid"] = (*Server).userConvertToUserID
+	handlers["user/authsucc"] = (*Server).userAuthsucc
+	handlers["user/getuserid"] = (*Server).userGetIDByMobile
+	handlers["user/get_userid_by_email"] = (*Server).userGetIDByEmail
+	handlers["user/getuserinfo"] = (*Server).oauthUserinfo
+	handlers["auth/getuserinfo"] = (*Server).authUserinfo
+	handlers["batch/invite"] = (*Server).batchInvite
+	handlers["corp/get_join_qrcode"] = (*Server).joinQrcode
+
+	handlers["department/create"] = (*Server).departmentCreate
+	handlers["department/update"] = (*Server).departmentUpdate
+	handlers["department/delete"] = (*Server).departmentDelete
+	handlers["department/get"] = (*Server).departmentGet
+	handlers["department/list"] = (*Server).departmentList
+	handlers["department/simplelist"] = (*Server).departmentSimpleList
+
+	handlers["tag/create"] = (*Server).tagCreate
+	handlers["tag/update"] = (*Server).tagUpdate
+	handlers["tag/delete"] = (*Server).tagDelete
+	handlers["tag/get"] = (*Server).tagGet
+	handlers["tag/addtagusers"] = (*Server).tagAddUsers
+	handlers["tag/deltagusers"] = (*Server).tagDelUsers
+	handlers["tag/list"] = (*Server).tagList
+}
+
+// AddUser 预置成员，已存在则覆盖
+func (s *Server) AddUser(u wecom.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.UserID] = &u
+}
+
+// User 读取成员当前的数据
+func (s *Server) User(userid string) (wecom.User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userid]
+	if !ok {
+		return wecom.User{}, false
+	}
+	return *u, true
+}
+
+// AddDepartment 预置部门，已存在则覆盖
+func (s *Server) AddDepartment(d wecom.Department) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.departments[d.Id] = &d
+}
+
+// Department 读取部门当前的数据
+func (s *Server) Department(id int) (wecom.Department, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.departments[id]
+	if !ok {
+		return wecom.Department{}, false
+	}
+	return *d, true
+}
+
+// AddTag 预置标签及其成员
+func (s *Server) AddTag(t wecom.Tag, userids []string, partyids []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags[t.TagId] = &tagData{tag: t, users: userids, parties: partyids}
+}
+
+// AddCode 预置网页授权的code，用于auth/getuserinfo与user/getuserinfo
+func (s *Server) AddCode(code, userid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code] = userid
+}
+
+func (s *Server) userCreate(r *apiRequest) (result, *apiError) {
+	var u wecom.User
+	if r.decode(&u) != nil || u.UserID == "" || u.Name == "" {
+		return nil, errInvalidParam
+	}
+	if _, ok := s.users[u.UserID]; ok {
+		return nil, fail(wecom.ErrCodeUserIDExists, "userid existed")
+	}
+	if e := s.checkDepartments(u.Department); e != nil {
+		return nil, e
+	}
+	if u.Status == 0 {
+		u.Status = 4
+	}
+	s.users[u.UserID] = &u
+	s.notifyUser("create_user", &u)
+	return result{}, nil
+}
+
+func (s *Server) userGet(r *apiRequest) (result, *apiError) {
+	u, ok := s.users[r.query.Get("userid")]
+	if !ok {
+		return nil, fail(wecom.ErrCodeUserNotFound, "userid not found")
+	}
+	return toResult(u), nil
+}
+
+func (s *Server) userUpdate(r *apiRequest) (result, *apiError) {
+	var fields map[string]any
+	if r.decode(&fields) != nil {
+		return nil, errInvalidParam
+	}
+	userid, _ := fields["userid"].(string)
+	u, ok := s.users[userid]
+	if !ok {
+		return nil, fail(wecom.ErrCodeUserNotFound, "userid not found")
+	}
+	// 只覆盖请求中携带的字段
+	merged := toResult(u)
+	for k, v := range fields {
+		merged[k] = v
+	}
+	var nu wecom.User
+	if fromResult(merged, &nu) != nil {
+		return nil, errInvalidParam
+	}
+	if e := s.checkDepartments(nu.Department); e != nil {
+		return nil, e
+	}
+	s.users[userid] = &nu
+	s.notifyUser("update_user", &nu)
+	return result{}, nil
+}
+
+func (s *Server) userDelete(r *apiRequest) (result, *apiError) {
+	userid := r.query.Get("userid")
+	if _, ok := s.users[userid]; !ok {
+		return nil, fail(wecom.ErrCodeUserNotFound, "userid not found")
+	}
+	s.deleteUser(userid)
+	return result{}, nil
+}
+
+func (s *Server) userBatchDelete(r *apiRequest) (result, *apiError) {
+	var req struct {
+		UseridList []string `json:"useridlist"`
+	}
+	if r.decode(&req) != nil || len(req.UseridList) == 0 {
+		return nil, errInvalidParam
+	}
+	for _, userid := range req.UseridList {
+		if _, ok := s.users[userid]; !ok {
+			return nil, fail(wecom.ErrCodeUserNotFound, "userid %s not found", userid)
+		}
+	}
+	for _, userid := range req.UseridList {
+		s.deleteUser(userid)
+	}
+	return result{}, nil
+}
+
+func (s *Server) deleteUser(userid string) {
+	delete(s.users, userid)
+	for _, t := range s.tags {
+		t.users = removeString(t.users, userid)
+	}
+	s.notifyEvent("delete_user", map[string]string{"UserID": userid})
+}
+
+func (s *Server) userSimpleList(r *apiRequest) (result, *apiError) {
+	users, e := s.usersInDepartment(r)
+	if e != nil {
+		return nil, e
+	}
+	list := make([]map[string]any, 0, len(users))
+	for _, u := range users {
+		list = append(list, map[string]any{
+			"userid":     u.UserID,
+			"name":       u.Name,
+			"department": u.Department,
+		})
+	}
+	return result{"userlist": list}, nil
+}
+
+func (s *Server) userList(r *apiRequest) (result, *apiError) {
+	users, e := s.usersInDepartment(r)
+	if e != nil {
+		return nil, e
+	}
+	return result{"userlist": users}, nil
+}
+
+func (s *Server) usersInDepartment(r *apiRequest) ([]*wecom.User, *apiError) {
+	id, err := strconv.Atoi(r.query.Get("department_id"))
+	if err != nil {
+		return nil, errInvalidParam
+	}
+	if _, ok := s.departments[id]; !ok {
+		return nil, fail(wecom.ErrCodeDepartmentNotFound, "department not found")
+	}
+	var users []*wecom.User
+	for _, u := range s.sortedUsers() {
+		if containsInt(u.Department, id) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (s *Server) userListID(r *apiRequest) (result, *apiError) {
+	var req struct {
+		Cursor string `json:"cursor"`
+		Limit  int    `json:"limit"`
+	}
+	if r.decode(&req) != nil {
+		return nil, errInvalidParam
+	}
+	if req.Limit <= 0 || req.Limit > 10000 {
+		req.Limit = 10000
+	}
+	type deptUser struct {
+		UserID     string `json:"userid"`
+		Department int    `json:"department"`
+	}
+	var all []deptUser
+	for _, u := range s.sortedUsers() {
+		for _, d := range u.Department {
+			all = append(all, deptUser{UserID: u.UserID, Department: d})
+		}
+	}
+	start, _ := strconv.Atoi(req.Cursor)
+	if start > len(all) {
+		start = len(all)
+	}
+	end := start + req.Limit
+	next := ""
+	if end < len(all) {
+		next = strconv.Itoa(end)
+	} else {
+		end = len(all)
+	}
+	return result{"next_cursor": next, "dept_user": all[start:end]}, nil
+}
+
+func (s *Server) userConvertToOpenID(r *apiRequest) (result, *apiError) {
+	var req struct {
+		UserID string `json:"userid"`
+	}
+	if r.decode(&req) != nil {
+		return nil, errInvalidParam
+	}
+	if _, ok := s.users[req.UserID]; !ok {
+		return nil, fail(wecom.ErrCodeUserNotFound, "userid not found")
+	}
+	return result{"openid": "openid-" + req.UserID}, nil
+}
+
+func (s *Server) userConvertToUserID(r *apiRequest) (result, *apiError) {
+	var req struct {
+		OpenID string `json:"openid"`
+	}
+	if r.decode(&req) != nil {
+		return nil, errInvalidParam
+	}
+	userid := strings.TrimPrefix(req.OpenID, "openid-")
+	if _, ok := s.users[userid]; !ok || userid == req.OpenID {
+		return nil, fail(wecom.ErrCodeUserNotFound, "openid not found")
+	}
+	return result{"userid": userid}, nil
+}
+
+func (s *Server) userAuthsucc(r *apiRequest) (result, *apiError) {
+	u, ok := s.users[r.query.Get("userid")]
+	if !ok {
+		return nil, fail(wecom.ErrCodeUserNotFound, "userid not found")
+	}
+	u.Status = 1
+	return result{}, nil
+}
+
+func (s *Server) userGetIDByMobile(r *apiRequest) (result, *apiError) {
+	var req struct {
+		Mobile string `json:"mobile"`
+	}
+	if r.decode(&req) != nil {
+		return nil, errInvalidParam
+	}
+	for _, u := range s.sortedUsers() {
+		if u.Mobile == req.Mobile {
+			return result{"userid": u.UserID}, nil
+		}
+	}
+	return nil, fail(wecom.ErrCodeUserNotFound, "mobile not found")
+}
+
+func (s *Server) userGetIDByEmail(r *apiRequest) (result, *apiError) {
+	var req struct {
+		Email     string `json:"email"`
+		EmailType int    `json:"email_type"`
+	}
+	if r.decode(&req) != nil {
+		return nil, errInvalidParam
+	}
+	for _, u := range s.sortedUsers() {
+		email := u.Email
+		if req.EmailType == 1 {
+			email = u.BizMail
+		}
+		if email != "" && email == req.Email {
+			return result{"userid": u.UserID}, nil
+		}
+	}
+	return nil, fail(wecom.ErrCodeUserNotFound, "email not found")
+}
+
+func (s *Server) authUserinfo(r *apiRequest) (result, *apiError) {
+	userid, ok := s.codes[r.query.Get("code")]
+	if !ok {
+		return nil, fail(wecom.ErrCodeInvalidOauthCode, "invalid code")
+	}
+	return result{"userid": userid}, nil
+}
+
+func (s *Server) oauthUserinfo(r *apiRequest) (result, *apiError) {
+	userid, ok := s.codes[r.query.Get("code")]
+	if !ok {
+		return nil, fail(wecom.ErrCodeInvalidOauthCode, "invalid code")
+	}
+	return result{"UserId": userid}, nil
+}
+
+func (s *Server) batchInvite(r *apiRequest) (result, *apiError) {
+	var req struct {
+		User  []string `json:"user"`
+		Party []string `json:"party"`
+		Tag   []string `json:"tag"`
+	}
+	if r.decode(&req) != nil {
+		return nil, errInvalidParam
+	}
+	var invalid wecom.UserInvalidList
+	for _, userid := range req.User {
+		if _, ok := s.users[userid]; !ok {
+			invalid.InvalidUser = append(invalid.InvalidUser, userid)
+		}
+	}
+	for _, p := range req.Party {
+		id, _ := strconv.Atoi(p)
+		if _, ok := s.departments[id]; !ok {
+			invalid.InvalidParty = append(invalid.InvalidParty, p)
+		}
+	}
+	for _, t := range req.Tag {
+		id, _ := strconv.Atoi(t)
+		if _, ok := s.tags[id]; !ok {
+			invalid.InvalidTag = append(invalid.InvalidTag, t)
+		}
+	}
+	return toResult(invalid), nil
+}
+
+func (s *Server) joinQrcode(r *apiRequest) (result, *apiError) {
+	size := r.query.Get("size_type")
+	if size == "" {
+		size = "1"
+	}
+	return result{"join_qrcode": s.URL + "/qrcode/" + s.corpID + "?size_type=" + size}, nil
+}
+
+func (s *Server) departmentCreate(r *apiRequest) (result, *apiError) {
+	var d wecom.Department
+	if r.decode(&d) != nil || d.Name == "" {
+		return nil, errInvalidParam
+	}
+	if _, ok := s.departments[d.ParentId]; !ok {
+		return nil, fail(wecom.ErrCodeParentDepartmentAbsent, "parent department not found")
+	}
+	if d.Id == 0 {
+		for id := range s.departments {
+			if id > d.Id {
+				d.Id = id
+			}
+		}
+		d.Id++
+	} else if _, ok := s.departments[d.Id]; ok {
+		return nil, fail(wecom.ErrCodeDepartmentExists, "department existed")
+	}
+	s.departments[d.Id] = &d
+	s.notifyParty("create_party", &d)
+	return result{"id": d.Id}, nil
+}
+
+func (s *Server) departmentUpdate(r *apiRequest) (result, *apiError) {
+	var fields map[string]any
+	if r.decode(&fields) != nil {
+		return nil, errInvalidParam
+	}
+	id, _ := fields["id"].(float64)
+	d, ok := s.departments[int(id)]
+	if !ok {
+		return nil, fail(wecom.ErrCodeDepartmentNotFound, "department not found")
+	}
+	merged := toResult(d)
+	for k, v := range fields {
+		merged[k] = v
+	}
+	var nd wecom.Department
+	if fromResult(merged, &nd) != nil {
+		return nil, errInvalidParam
+	}
+	s.departments[nd.Id] = &nd
+	s.notifyParty("update_party", &nd)
+	return result{}, nil
+}
+
+func (s *Server) departmentDelete(r *apiRequest) (result, *apiError) {
+	id, err := strconv.Atoi(r.query.Get("id"))
+	if err != nil {
+		return nil, errInvalidParam
+	}
+	if _, ok := s.departments[id]; !ok {
+		return nil, fail(wecom.ErrCodeDepartmentNotFound, "department not found")
+	}
+	for _, d := range s.departments {
+		if d.ParentId == id {
+			return nil, fail(wecom.ErrCodeInvalidDepartmentID, "department has sub departments")
+		}
+	}
+	for _, u := range s.users {
+		if containsInt(u.Department, id) {
+			return nil, fail(wecom.ErrCodeInvalidDepartmentID, "department has members")
+		}
+	}
+	delete(s.departments, id)
+	s.notifyEvent("delete_party", map[string]string{"Id": strconv.Itoa(id)})
+	return result{}, nil
+}
+
+func (s *Server) departmentGet(r *apiRequest) (result, *apiError) {
+	id, err := strconv.Atoi(r.query.Get("id"))
+	if err != nil {
+		return nil, errInvalidParam
+	}
+	d, ok := s.departments[id]
+	if !ok {
+		return nil, fail(wecom.ErrCodeDepartmentNotFound, "department not found")
+	}
+	return result{"department": d}, nil
+}
+
+func (s *Server) departmentList(r *apiRequest) (result, *apiError) {
+	list, e := s.subDepartments(r)
+	if e != nil {
+		return nil, e
+	}
+	return result{"department": list}, nil
+}
+
+func (s *Server) departmentSimpleList(r *apiRequest) (result, *apiError) {
+	list, e := s.subDepartments(r)
+	if e != nil {
+		return nil, e
+	}
+	simple := make([]map[string]int, 0, len(list))
+	for _, d := range list {
+		simple = append(simple, map[string]int{"id": d.Id, "parentid": d.ParentId, "order": d.Order})
+	}
+	return result{"department_id": simple}, nil
+}
+
+// subDepartments 返回指定部门及其递归下属部门，未指定id时返回全部部门
+func (s *Server) subDepartments(r *apiRequest) ([]*wecom.Department, *apiError) {
+	ids := make([]int, 0, len(s.departments))
+	for id := range s.departments {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	if r.query.Get("id") == "" {
+		list := make([]*wecom.Department, 0, len(ids))
+		for _, id := range ids {
+			list = append(list, s.departments[id])
+		}
+		return list, nil
+	}
+	root, err := strconv.Atoi(r.query.Get("id"))
+	if err != nil {
+		return nil, errInvalidParam
+	}
+	if _, ok := s.departments[root]; !ok {
+		return nil, fail(wecom.ErrCodeDepartmentNotFound, "department not found")
+	}
+	var list []*wecom.Department
+	for _, id := range ids {
+		for p := id; ; {
+			if p == root {
+				list = append(list, s.departments[id])
+				break
+			}
+			d, ok := s.departments[p]
+			if !ok || d.ParentId == 0 || d.ParentId == p {
+				break
+			}
+			p = d.ParentId
+		}
+	}
+	return list, nil
+}
+
+func (s *Server) tagCreate(r *apiRequest) (result, *apiError) {
+	var t wecom.Tag
+	if r.decode(&t) != nil || t.Tagname == "" {
+		return nil, fail(wecom.ErrCodeInvalidTagName, "invalid tagname")
+	}
+	for _, exist := range s.tags {
+		if exist.tag.Tagname == t.Tagname {
+			return nil, fail(wecom.ErrCodeInvalidTagName, "tagname existed")
+		}
+	}
+	if t.TagId == 0 {
+		for id := range s.tags {
+			if id > t.TagId {
+				t.TagId = id
+			}
+		}
+		t.TagId++
+	} else if _, ok := s.tags[t.TagId]; ok {
+		return nil, fail(wecom.ErrCodeInvalidTagID, "tagid existed")
+	}
+	s.tags[t.TagId] = &tagData{tag: t}
+	return result{"tagid": t.TagId}, nil
+}
+
+func (s *Server) tagUpdate(r *apiRequest) (result, *apiError) {
+	var t wecom.Tag
+	if r.decode(&t) != nil || t.Tagname == "" {
+		return nil, fail(wecom.ErrCodeInvalidTagName, "invalid tagname")
+	}
+	td, ok := s.tags[t.TagId]
+	if !ok {
+		return nil, fail(wecom.ErrCodeInvalidTagID, "tag not found")
+	}
+	td.tag.Tagname = t.Tagname
+	return result{}, nil
+}
+
+func (s *Server) tagDelete(r *apiRequest) (result, *apiError) {
+	id, err := strconv.Atoi(r.query.Get("tagid"))
+	if err != nil {
+		return nil, errInvalidParam
+	}
+	if _, ok := s.tags[id]; !ok {
+		return nil, fail(wecom.ErrCodeInvalidTagID, "tag not found")
+	}
+	delete(s.tags, id)
+	return result{}, nil
+}
+
+func (s *Server) tagGet(r *apiRequest) (result, *apiError) {
+	id, err := strconv.Atoi(r.query.Get("tagid"))
+	if err != nil {
+		return nil, errInvalidParam
+	}
+	td, ok := s.tags[id]
+	if !ok {
+		return nil, fail(wecom.ErrCodeInvalidTagID, "tag not found")
+	}
+	users := make([]map[string]string, 0, len(td.users))
+	for _, userid := range td.users {
+		name := ""
+		if u, ok := s.users[userid]; ok {
+			name = u.Name
+		}
+		users = append(users, map[string]string{"userid": userid, "name": name})
+	}
+	parties := td.parties
+	if parties == nil {
+		parties = []int{}
+	}
+	return result{"tagname": td.tag.Tagname, "userlist": users, "partylist": parties}, nil
+}
+
+// tagUsersRequest 增删标签成员的请求
+type tagUsersRequest struct {
+	TagId     int      `json:"tagid"`
+	UserList  []string `json:"userlist"`
+	PartyList []int    `json:"partylist"`
+}
+
+func (s *Server) tagAddUsers(r *apiRequest) (result, *apiError) {
+	return s.changeTagUsers(r, true)
+}
+
+func (s *Server) tagDelUsers(r *apiRequest) (result, *apiError) {
+	return s.changeTagUsers(r, false)
+}
+
+func (s *Server) changeTagUsers(r *apiRequest, add bool) (result, *apiError) {
+	var req tagUsersRequest
+	if r.decode(&req) != nil || len(req.UserList)+len(req.PartyList) == 0 {
+		return nil, errInvalidParam
+	}
+	td, ok := s.tags[req.TagId]
+	if !ok {
+		return nil, fail(wecom.ErrCodeInvalidTagID, "tag not found")
+	}
+	var invalidUsers []string
+	var invalidParties []int
+	var changedUsers []string
+	var changedParties []int
+	for _, userid := range req.UserList {
+		if _, ok := s.users[userid]; !ok {
+			invalidUsers = append(invalidUsers, userid)
+			continue
+		}
+		if add && !containsString(td.users, userid) {
+			td.users = append(td.users, userid)
+			changedUsers = append(changedUsers, userid)
+		} else if !add && containsString(td.users, userid) {
+			td.users = removeString(td.users, userid)
+			changedUsers = append(changedUsers, userid)
+		}
+	}
+	for _, id := range req.PartyList {
+		if _, ok := s.departments[id]; !ok {
+			invalidParties = append(invalidParties, id)
+			continue
+		}
+		if add && !containsInt(td.parties, id) {
+			td.parties = append(td.parties, id)
+			changedParties = append(changedParties, id)
+		} else if !add && containsInt(td.parties, id) {
+			td.parties = removeInt(td.parties, id)
+			changedParties = append(changedParties, id)
+		}
+	}
+	s.notifyTag(td.tag.TagId, add, changedUsers, changedParties)
+	res := result{}
+	if len(invalidUsers) > 0 {
+		res["invalidlist"] = strings.Join(invalidUsers, "|")
+	}
+	if len(invalidParties) > 0 {
+		res["invalidparty"] = invalidParties
+	}
+	return res, nil
+}
+
+func (s *Server) tagList(_ *apiRequest) (result, *apiError) {
+	list := make([]wecom.Tag, 0, len(s.tags))
+	for _, td := range s.tags {
+		list = append(list, td.tag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].TagId < list[j].TagId })
+	return result{"taglist": list}, nil
+}
+
+// checkDepartments 校验部门均存在，调用方需持有锁
+func (s *Server) checkDepartments(ids []int) *apiError {
+	for _, id := range ids {
+		if _, ok := s.departments[id]; !ok {
+			return fail(wecom.ErrCodeInvalidDepartmentID, "department %d not found", id)
+		}
+	}
+	return nil
+}
+
+// sortedUsers 按userid排序返回全部成员，调用方需持有锁
+func (s *Server) sortedUsers() []*wecom.User {
+	users := make([]*wecom.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func removeInt(list []int, v int) []int {
+	out := list[:0]
+	for _, x := range list {
+		if x != v {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func removeString(list []string, v string) []string {
+	out := list[:0]
+	for _, x := range list {
+		if x != v {
+			out = append(out, x)
+		}
+	}
+	return out
+}
@@ -0,0 +1,306 @@
+// Package wecomtest 提供基于httptest的企业微信模拟服务，用于离线测试
+//
+//	srv := wecomtest.NewServer("ww-corp", "secret")
+//	defer srv.Close()
+//	srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+//	w := srv.NewClient("secret") // 或 wecom.New("ww-corp", "secret", srv.Option())
+//	u, err := w.UserGet("zhangsan")
+package wecomtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang-common/wecom"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	basePath      = "/cgi-bin/"
+	downloadPath  = "/download/"
+	tokenLifetime = 7200 * time.Second
+)
+
+// Server 内存中的企业微信模拟服务
+// 实现了gettoken、成员、部门、标签、异步导入导出接口，并可向配置的回调地址推送事件
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	corpID      string
+	secrets     map[string]bool
+	tokens      map[string]time.Time // access_token -> 过期时间
+	users       map[string]*wecom.User
+	departments map[int]*wecom.Department
+	tags        map[int]*tagData
+	codes       map[string]string // oauth code -> userid
+	media       map[string]*importMedia
+	jobs        map[string]*job
+	downloads   map[string][]byte
+	faults      []*Fault
+	latency     time.Duration
+	seq         int
+	callback    *CallbackConfig
+	pending     sync.WaitGroup
+	cbErrs      []error
+}
+
+// NewServer 创建并启动模拟服务
+// secrets - 允许获取token的secret，同一企业的多个secret(应用、通讯录同步等)均可传入
+func NewServer(corpID string, secrets ...string) *Server {
+	s := &Server{
+		corpID:      corpID,
+		secrets:     make(map[string]bool),
+		tokens:      make(map[string]time.Time),
+		users:       make(map[string]*wecom.User),
+		departments: make(map[int]*wecom.Department),
+		tags:        make(map[int]*tagData),
+		codes:       make(map[string]string),
+		media:       make(map[string]*importMedia),
+		jobs:        make(map[string]*job),
+		downloads:   make(map[string][]byte),
+	}
+	for _, secret := range secrets {
+		s.secrets[secret] = true
+	}
+	// 根部门
+	s.departments[1] = &wecom.Department{Id: 1, Name: corpID, ParentId: 0}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Option 返回连接到模拟服务的客户端配置
+func (s *Server) Option() wecom.Option {
+	base := wecom.WithBaseURL(s.URL + "/cgi-bin")
+	client := wecom.WithHTTPClient(s.Server.Client())
+	return func(w *wecom.Wecom) {
+		base(w)
+		client(w)
+	}
+}
+
+// NewClient 创建连接到模拟服务的客户端
+func (s *Server) NewClient(secret string, opts ...wecom.Option) *wecom.Wecom {
+	return wecom.New(s.corpID, secret, append([]wecom.Option{s.Option()}, opts...)...)
+}
+
+// Close 等待进行中的回调推送后关闭服务
+func (s *Server) Close() {
+	s.pending.Wait()
+	s.Server.Close()
+}
+
+// Fault 故障注入规则
+type Fault struct {
+	Path    string        // 接口路径，如"user/get"、"gettoken"，为空则匹配所有接口
+	Errcode int           // 返回的错误码，为0则只注入延迟
+	Errmsg  string        // 返回的错误信息
+	Latency time.Duration // 响应前的延迟
+	Times   int           // 生效次数，0表示一直生效
+}
+
+// InjectFault 注入故障，多个规则按注入顺序匹配第一个
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.Path = strings.Trim(f.Path, "/")
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults 清除所有故障规则
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// SetLatency 为所有接口设置固定延迟
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// ExpireTokens 使已发放的token全部过期，之后的请求返回42001
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t := range s.tokens {
+		s.tokens[t] = time.Time{}
+	}
+}
+
+// apiRequest 一次接口请求
+type apiRequest struct {
+	query url.Values
+	body  []byte
+}
+
+func (r *apiRequest) decode(v any) error {
+	return json.Unmarshal(r.body, v)
+}
+
+// result 响应中除errcode/errmsg之外的字段
+type result map[string]any
+
+// apiError 模拟服务返回的错误码
+type apiError struct {
+	code int
+	msg  string
+}
+
+func fail(code wecom.ErrCode, format string, args ...any) *apiError {
+	return &apiError{code: int(code), msg: fmt.Sprintf(format, args...)}
+}
+
+var errInvalidParam = fail(wecom.ErrCodeInvalidParam, "invalid parameter")
+
+// handler 接口处理函数，调用时已持有s.mu
+type handler func(s *Server, r *apiRequest) (result, *apiError)
+
+var handlers = map[string]handler{}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, downloadPath) {
+		s.serveDownload(rw, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, basePath) {
+		http.NotFound(rw, r)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, basePath)
+	req := &apiRequest{query: r.URL.Query()}
+	if r.Body != nil {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSON(rw, nil, fail(wecom.ErrCodeSystemBusy, "read body: %v", err))
+			return
+		}
+		req.body = b
+	}
+
+	s.mu.Lock()
+	latency, fault := s.matchFault(p)
+	s.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if fault != nil {
+		writeJSON(rw, nil, fault)
+		return
+	}
+
+	s.mu.Lock()
+	res, apiErr := s.handle(p, req)
+	s.mu.Unlock()
+	writeJSON(rw, res, apiErr)
+}
+
+func (s *Server) handle(p string, req *apiRequest) (result, *apiError) {
+	if p == "gettoken" {
+		return s.getToken(req)
+	}
+	if e := s.checkToken(req.query.Get("access_token")); e != nil {
+		return nil, e
+	}
+	h, ok := handlers[p]
+	if !ok {
+		return nil, fail(wecom.ErrCodeAPIForbidden, "api %s not supported by wecomtest", p)
+	}
+	return h(s, req)
+}
+
+// matchFault 返回需要注入的延迟与错误，调用方需持有锁
+func (s *Server) matchFault(p string) (time.Duration, *apiError) {
+	latency := s.latency
+	for i, f := range s.faults {
+		if f.Path != "" && f.Path != p {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		latency += f.Latency
+		if f.Errcode == 0 {
+			return latency, nil
+		}
+		return latency, &apiError{code: f.Errcode, msg: f.Errmsg}
+	}
+	return latency, nil
+}
+
+func (s *Server) getToken(req *apiRequest) (result, *apiError) {
+	if req.query.Get("corpid") != s.corpID {
+		return nil, fail(wecom.ErrCodeInvalidCorpID, "invalid corpid")
+	}
+	if !s.secrets[req.query.Get("corpsecret")] {
+		return nil, fail(wecom.ErrCodeInvalidSecret, "invalid credential")
+	}
+	token := s.nextID("token")
+	s.tokens[token] = time.Now().Add(tokenLifetime)
+	return result{
+		"access_token": token,
+		"expires_in":   int(tokenLifetime / time.Second),
+	}, nil
+}
+
+func (s *Server) checkToken(token string) *apiError {
+	if token == "" {
+		return fail(wecom.ErrCodeMissingAccessToken, "access_token missing")
+	}
+	expire, ok := s.tokens[token]
+	if !ok {
+		return fail(wecom.ErrCodeInvalidAccessToken, "invalid access_token")
+	}
+	if time.Now().After(expire) {
+		return fail(wecom.ErrCodeAccessTokenExpired, "access_token expired")
+	}
+	return nil
+}
+
+// nextID 生成递增的唯一标识，调用方需持有锁
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%d", prefix, s.seq)
+}
+
+func writeJSON(rw http.ResponseWriter, res result, e *apiError) {
+	out := make(map[string]any, len(res)+2)
+	for k, v := range res {
+		out[k] = v
+	}
+	if e != nil {
+		out = map[string]any{"errcode": e.code, "errmsg": e.msg}
+	} else {
+		out["errcode"] = 0
+		out["errmsg"] = "ok"
+	}
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(rw).Encode(out)
+}
+
+// toResult 将结构体按json字段转为result
+func toResult(v any) result {
+	b, _ := json.Marshal(v)
+	var r result
+	_ = json.Unmarshal(b, &r)
+	return r
+}
+
+// fromResult 将result按json字段解析到结构体
+func fromResult(r result, v any) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,439 @@
+package wecomtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-common/wecom"
+	"github.com/golang-common/wecom/wecomtest"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testCorpID = "ww-test"
+	testSecret = "secret"
+)
+
+// callCounter 统计经过中间件的各接口调用次数，包括重放
+type callCounter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *callCounter) middleware(next wecom.Invoker) wecom.Invoker {
+	return func(ctx context.Context, call *wecom.CallInfo) error {
+		c.mu.Lock()
+		c.calls[call.Path]++
+		c.mu.Unlock()
+		return next(ctx, call)
+	}
+}
+
+func newTestServer(t *testing.T) *wecomtest.Server {
+	t.Helper()
+	srv := wecomtest.NewServer(testCorpID, testSecret)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestContact(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}, Mobile: "13800000000"})
+	w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil))
+
+	u, err := w.UserGet("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "张三" || u.Mobile != "13800000000" {
+		t.Fatalf("UserGet = %+v", u)
+	}
+	userID, err := w.UserGetIDByMobile("13800000000")
+	if err != nil || userID != "zhangsan" {
+		t.Fatalf("UserGetIDByMobile = %q, %v", userID, err)
+	}
+
+	deptID, err := w.DepartmentCreate(wecom.Department{Name: "研发中心", ParentId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.UserCreate(wecom.User{UserID: "lisi", Name: "李四", Department: []int{deptID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := w.UserListGetByDepartment(deptID)
+	if err != nil || len(users) != 1 || users[0].UserID != "lisi" {
+		t.Fatalf("UserListGetByDepartment = %+v, %v", users, err)
+	}
+	if _, ok := srv.User("lisi"); !ok {
+		t.Fatal("created user not found in server")
+	}
+
+	tagID, err := w.TagCreate("乒乓球协会")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid, _, err := w.TagAddUsers(tagID, []string{"zhangsan", "nobody"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invalid != "nobody" {
+		t.Errorf("invalidlist = %q, want nobody", invalid)
+	}
+	name, _, members, err := w.TagGetUser(tagID)
+	if err != nil || name != "乒乓球协会" || len(members) != 1 || members[0].UserID != "zhangsan" {
+		t.Fatalf("TagGetUser = %q %+v, %v", name, members, err)
+	}
+
+	err = w.UserDelete("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.UserGet("zhangsan")
+	if !errors.Is(err, wecom.ErrCodeUserNotFound) {
+		t.Fatalf("UserGet after delete: err = %v", err)
+	}
+}
+
+func TestTokenExpiryReplay(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+	counter := &callCounter{calls: map[string]int{}}
+	w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil), wecom.WithMiddleware(counter.middleware))
+
+	if _, err := w.UserGet("zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	srv.ExpireTokens()
+	// token过期后自动刷新并重放请求
+	if _, err := w.UserGet("zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	if counter.calls["gettoken"] != 2 {
+		t.Fatalf("gettoken calls = %d, want 2", counter.calls["gettoken"])
+	}
+
+	srv.ExpireTokens()
+	w = srv.NewClient(testSecret, wecom.WithRateLimiter(nil), wecom.WithTokenRetry(false))
+	if _, err := w.UserGet("zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	srv.ExpireTokens()
+	_, err := w.UserGet("zhangsan")
+	if !errors.Is(err, wecom.ErrCodeAccessTokenExpired) {
+		t.Fatalf("err = %v, want 42001 without token retry", err)
+	}
+}
+
+func TestTokenRetryOnFault(t *testing.T) {
+	for _, code := range []wecom.ErrCode{wecom.ErrCodeInvalidAccessToken, wecom.ErrCodeAccessTokenExpired} {
+		t.Run(fmt.Sprint(int(code)), func(t *testing.T) {
+			srv := newTestServer(t)
+			srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+			for _, retry := range []bool{true, false} {
+				counter := &callCounter{calls: map[string]int{}}
+				w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil),
+					wecom.WithTokenRetry(retry), wecom.WithMiddleware(counter.middleware))
+				if err := w.Auth(); err != nil {
+					t.Fatal(err)
+				}
+				srv.InjectFault(wecomtest.Fault{Path: "user/get", Errcode: int(code), Times: 1})
+				u, err := w.UserGet("zhangsan")
+				if retry {
+					// 刷新一次token并重放一次请求
+					if err != nil || u.Name != "张三" {
+						t.Fatalf("UserGet = %+v, %v", u, err)
+					}
+					if counter.calls["gettoken"] != 2 || counter.calls["user/get"] != 2 {
+						t.Fatalf("calls = %v, want 2 gettoken and 2 user/get", counter.calls)
+					}
+					continue
+				}
+				var apiErr *wecom.APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != int(code) {
+					t.Fatalf("err = %v, want APIError %d without retry", err, code)
+				}
+				if counter.calls["gettoken"] != 1 || counter.calls["user/get"] != 1 {
+					t.Fatalf("calls = %v, want no refresh and no replay", counter.calls)
+				}
+			}
+		})
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+	w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil), wecom.WithFrequencyBackoff(2, 0))
+
+	srv.InjectFault(wecomtest.Fault{Path: "user/get", Errcode: int(wecom.ErrCodeSystemBusy), Errmsg: "system busy", Times: 1})
+	_, err := w.UserGet("zhangsan")
+	var apiErr *wecom.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != int(wecom.ErrCodeSystemBusy) {
+		t.Fatalf("err = %v, want errcode -1", err)
+	}
+	if _, err = w.UserGet("zhangsan"); err != nil {
+		t.Fatalf("fault should be used up after Times: %v", err)
+	}
+
+	// 频率限制按退避策略重试
+	srv.InjectFault(wecomtest.Fault{Path: "user/get", Errcode: int(wecom.ErrCodeAPIFreqLimit), Times: 2})
+	if _, err = w.UserGet("zhangsan"); err != nil {
+		t.Fatalf("frequency limit should be retried: %v", err)
+	}
+	srv.InjectFault(wecomtest.Fault{Path: "user/get", Errcode: int(wecom.ErrCodeAPIFreqLimit), Times: 3})
+	_, err = w.UserGet("zhangsan")
+	if !errors.Is(err, wecom.ErrCodeAPIFreqLimit) {
+		t.Fatalf("err = %v, want 45009 after retries", err)
+	}
+
+	// 其他接口不受影响
+	srv.InjectFault(wecomtest.Fault{Path: "tag/list", Errcode: int(wecom.ErrCodeSystemBusy)})
+	if _, err = w.UserGet("zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	srv.ClearFaults()
+	if _, err = w.TagList(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.InjectFault(wecomtest.Fault{Path: "user/get", Latency: 200 * time.Millisecond, Times: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = w.UserGetContext(ctx, "zhangsan")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddImportMedia("media-users", []wecom.User{
+		{UserID: "zhangsan", Name: "张三", Department: []int{1}},
+		{UserID: "lisi", Name: "李四", Department: []int{1}},
+	}, nil)
+	w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil))
+
+	jobID, err := w.SyncImportUpdateUser(wecom.Import{MediaID: "media-users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := w.SyncImportGetResult(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != 3 || r.Type != wecom.JobTypeSyncUser || r.Total != 2 {
+		t.Fatalf("ImportResult = %+v", r)
+	}
+	var users []wecom.ImportUserResult
+	if err = json.Unmarshal(r.Result, &users); err != nil || len(users) != 2 {
+		t.Fatalf("result = %s, %v", r.Result, err)
+	}
+	if _, ok := srv.User("lisi"); !ok {
+		t.Fatal("imported user not found in server")
+	}
+}
+
+func TestExportDownload(t *testing.T) {
+	const aeskey = "0123456789abcdef0123456789abcdef"
+	srv := newTestServer(t)
+	srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}, Mobile: "13800000000"})
+	srv.AddUser(wecom.User{UserID: "lisi", Name: "李四", Department: []int{1}})
+	w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil))
+
+	jobID, err := w.AsyncExportUserDetail(aeskey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := w.AsyncExportGetResult(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != 2 || len(r.DataList) != 1 {
+		t.Fatalf("ExportResult = %+v", r)
+	}
+	b, err := w.AsyncExportDownloadResult(aeskey, r.DataList[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []wecom.User
+	if err = json.Unmarshal(b, &users); err != nil {
+		t.Fatalf("decrypted = %q: %v", b, err)
+	}
+	if len(users) != 2 || users[0].UserID != "lisi" || users[1].Mobile != "13800000000" {
+		t.Fatalf("users = %+v", users)
+	}
+
+	// 校验md5失败时返回错误
+	bad := r.DataList[0]
+	bad.Md5 = "00000000000000000000000000000000"
+	if _, err = w.AsyncExportDownloadResult(aeskey, bad); err == nil {
+		t.Fatal("expected md5 mismatch")
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	const (
+		token  = "QDG6eK"
+		aeskey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	)
+	cs, err := wecom.NewCallbackServer(token, aeskey, testCorpID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu      sync.Mutex
+		created []string
+	)
+	cs.HandleChangeContact("create_user", func(ctx context.Context, evt *wecom.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, evt.Data.(*wecom.ContactUserEvent).UserID)
+		return nil
+	})
+	hs := httptest.NewServer(cs)
+	defer hs.Close()
+
+	srv := newTestServer(t)
+	srv.SetCallback(wecomtest.CallbackConfig{URL: hs.URL, Token: token, EncodingAESKey: aeskey, AgentID: "1000002"})
+	w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil))
+	err = w.UserCreate(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.WaitCallbacks()
+	if errs := srv.CallbackErrors(); len(errs) > 0 {
+		t.Fatalf("callback errors: %v", errs)
+	}
+	if len(created) != 1 || created[0] != "zhangsan" {
+		t.Fatalf("created = %v", created)
+	}
+}
+
+func TestExportTagMember(t *testing.T) {
+	const aeskey = "0123456789abcdef0123456789abcdef"
+	srv := newTestServer(t)
+	srv.AddUser(wecom.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+	const tagID = 12
+	srv.AddTag(wecom.Tag{TagId: tagID, Tagname: "乒乓球协会"}, []string{"zhangsan"}, []int{1})
+	w := srv.NewClient(testSecret, wecom.WithRateLimiter(nil))
+
+	jobID, err := w.AsyncExportTagMember(tagID, aeskey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := w.AsyncExportGetResult(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != 2 || len(r.DataList) != 1 {
+		t.Fatalf("ExportResult = %+v", r)
+	}
+	b, err := w.AsyncExportDownloadResult(aeskey, r.DataList[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list wecom.TagMemberList
+	if err = json.Unmarshal(b, &list); err != nil {
+		t.Fatalf("decrypted = %q: %v", b, err)
+	}
+	if list.TagName != "乒乓球协会" || len(list.UserList) != 1 || list.UserList[0].UserID != "zhangsan" ||
+		len(list.PartyList) != 1 || list.PartyList[0] != 1 {
+		t.Fatalf("TagMemberList = %+v", list)
+	}
+
+	_, err = w.AsyncExportTagMember(tagID+1, aeskey)
+	if !errors.Is(err, wecom.ErrCodeInvalidTagID) {
+		t.Fatalf("err = %v, want invalid tagid", err)
+	}
+}
+
+// tokenRecorder 记录每个secret获取到的token，以及每个接口调用使用的token
+type tokenRecorder struct {
+	mu       sync.Mutex
+	bySecret map[string]string
+	byPath   map[string]string
+}
+
+func (rec *tokenRecorder) middleware(next wecom.Invoker) wecom.Invoker {
+	return func(ctx context.Context, call *wecom.CallInfo) error {
+		err := next(ctx, call)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		q := call.Request.URL.Query()
+		if call.Path != "gettoken" {
+			rec.byPath[call.Path] = q.Get("access_token")
+			return err
+		}
+		var token struct {
+			AccessToken string `json:"access_token"`
+		}
+		if json.Unmarshal(call.ResponseBody, &token) == nil {
+			rec.bySecret[q.Get("corpsecret")] = token.AccessToken
+		}
+		return err
+	}
+}
+
+func TestSecretRouting(t *testing.T) {
+	srv := wecomtest.NewServer(testCorpID, testSecret, "contact", "ext", "approval", "checkin")
+	t.Cleanup(srv.Close)
+	tests := []struct {
+		name  string
+		opts  []wecom.Option
+		paths map[string]string // 接口路径 -> 期望使用的secret
+	}{
+		{"capability secrets", []wecom.Option{
+			wecom.WithSecret(wecom.SecretContact, "contact"),
+			wecom.WithSecret(wecom.SecretExternalContact, "ext"),
+			wecom.WithSecret(wecom.SecretApproval, "approval"),
+			wecom.WithSecret(wecom.SecretCheckin, "checkin"),
+		}, map[string]string{
+			"user/get":               "contact",
+			"department/list":        "contact",
+			"tag/list":               "contact",
+			"user/getuserinfo":       testSecret,
+			"externalcontact/list":   "ext",
+			"oa/getapprovaldetail":   "approval",
+			"checkin/getcheckindata": "checkin",
+			"message/send":           testSecret,
+		}},
+		{"app secret only", nil, map[string]string{
+			"user/get":               testSecret,
+			"department/list":        testSecret,
+			"externalcontact/list":   testSecret,
+			"oa/getapprovaldetail":   testSecret,
+			"checkin/getcheckindata": testSecret,
+		}},
+		{"partial", []wecom.Option{
+			wecom.WithSecret(wecom.SecretContact, "contact"),
+		}, map[string]string{
+			"user/get":               "contact",
+			"externalcontact/list":   testSecret,
+			"checkin/getcheckindata": testSecret,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &tokenRecorder{bySecret: map[string]string{}, byPath: map[string]string{}}
+			opts := append([]wecom.Option{wecom.WithRateLimiter(nil), wecom.WithMiddleware(rec.middleware)}, tt.opts...)
+			w := srv.NewClient(testSecret, opts...)
+			for p, secret := range tt.paths {
+				// 模拟服务未实现的接口返回错误，这里只关心请求使用的token
+				_, _ = wecom.Get[wecom.Error](context.Background(), w, p, nil)
+				token, ok := rec.bySecret[secret]
+				if !ok {
+					t.Errorf("%s: no token fetched with secret %q", p, secret)
+					continue
+				}
+				if rec.byPath[p] != token {
+					t.Errorf("%s: used token %q, want token of secret %q (%q)", p, rec.byPath[p], secret, token)
+				}
+			}
+		})
+	}
+}